@@ -7,6 +7,16 @@ const (
 	ALG_HIGHEST_SELECT = iota
 )
 
+/**
+ * Search radius in meters when people should stay in building, e.g. typhoon
+ */
+const ALG_IN_BUILDING_RADIUS = 50
+
+/**
+ * Search radius in meters after dark, nearby places are preferred
+ */
+const ALG_DARK_RADIUS = 500
+
 type algUserData struct {
 	lat float64
 	lng float64
@@ -9,6 +9,7 @@ import (
 	mgo "gopkg.in/mgo.v2"
 
 	"github.com/kr/pretty"
+	"github.com/xu354cjo1008/eatingFinder/geography/geocoding"
 	"github.com/xu354cjo1008/eatingFinder/geography/place"
 	"github.com/xu354cjo1008/eatingFinder/meteorology"
 )
@@ -17,6 +18,7 @@ type ccAlgorithm struct {
 	place    *nearPlace.GoogleBase
 	meteo    *meteorology.Meteorology
 	storage  *Storage
+	clock    meteorology.Clock
 	logLevel int
 	logger   *log.Logger
 }
@@ -45,6 +47,56 @@ func (alg *ccAlgorithm) checkIsDiscovered(db *mgo.Database, lat float64, lng flo
 	return false
 }
 
+/**
+ * Shrink the search radius to the building when typhoon warning is in effect in the county
+ */
+func (alg *ccAlgorithm) radiusOfWarnings(city string, size int) int {
+
+	warnings, err := alg.meteo.GetWarnings(city)
+	if err != nil {
+		if alg.logLevel == 1 {
+			alg.logger.Println(err)
+		}
+		return size
+	}
+	if meteorology.HasWarning(warnings, meteorology.WARN_TYPHOON) && size > ALG_IN_BUILDING_RADIUS {
+		if alg.logLevel == 1 {
+			alg.logger.Println("typhoon warning in", city, "-> radius: ", ALG_IN_BUILDING_RADIUS)
+		}
+		return ALG_IN_BUILDING_RADIUS
+	}
+	return size
+}
+
+/**
+ * Prefer nearby places after dark
+ */
+func (alg *ccAlgorithm) radiusOfDaylight(userData algUserData, size int) int {
+
+	if alg.meteo.IsDark(userData.lat, userData.lng) && size > ALG_DARK_RADIUS {
+		if alg.logLevel == 1 {
+			alg.logger.Println("dark outside -> radius: ", ALG_DARK_RADIUS)
+		}
+		return ALG_DARK_RADIUS
+	}
+	return size
+}
+
+/**
+ * Limit the search radius to the walking distance suitable for the weather
+ */
+func (alg *ccAlgorithm) radiusOfWeather(weather meteorology.Weather, size int) int {
+
+	suitability := config.suitability.Score(&weather)
+	if alg.logLevel == 1 {
+		alg.logger.Println("outing suitability: ", suitability)
+	}
+	if suitability.MaxDistance > 0 && size > suitability.MaxDistance {
+		return suitability.MaxDistance
+	}
+	return size
+}
+
 func (alg *ccAlgorithm) findRestaurant(lat float64, lng float64) {
 
 }
@@ -56,6 +108,25 @@ func (alg *ccAlgorithm) findRestaurantList(mode int, userData algUserData, size
 	if alg.logLevel == 1 {
 		alg.logger.Println("enter findRestaurantList -> lat: ", userData.lat, "lng: ", userData.lng)
 	}
+	// address and weather snapshot saved with every choice, the address is looked up once
+	address := geocoding.Address{}
+	weather := meteorology.Weather{}
+	data, err := addressOfLatlng(userData.lat, userData.lng, "en")
+	if err == nil {
+		address = *data
+		size = alg.radiusOfWarnings(address.County, size)
+	} else if alg.logLevel == 1 {
+		alg.logger.Println(err)
+	}
+	size = alg.radiusOfDaylight(userData, size)
+	if address.County != "" {
+		if data, err := alg.meteo.GetWeather(address.County); err == nil {
+			weather = *data
+			size = alg.radiusOfWeather(weather, size)
+		} else if alg.logLevel == 1 {
+			alg.logger.Println(err)
+		}
+	}
 	// try to get db instance(maybe failed because there are no enougth session in pool)
 	db, err = alg.storage.getDb(config.dbName, config.dbUsername, config.dbPassword)
 	if err != nil {
@@ -115,6 +186,10 @@ func (alg *ccAlgorithm) findRestaurantList(mode int, userData algUserData, size
 						}
 						restaurantElement.Rank = rank
 						element.Restaurant = restaurantElement
+						element.County = address.County
+						element.District = address.District
+						element.Weather = weather
+						element.Time = alg.clock.Now()
 
 						err := alg.storage.insertChoice(db, element)
 						if err != nil {
@@ -152,12 +227,19 @@ func newCCAlgorithm(logFile io.Writer) *ccAlgorithm {
 		return nil
 	}
 
+	meteo, err := meteorologyOf()
+	if err != nil {
+		log.Fatalln("Failed to create meteorology instance")
+		return nil
+	}
+
 	storage := NewStorage(config.dbUrl)
 
 	alg := ccAlgorithm{
 		place:    near,
-		meteo:    meteorology.NewMeteorology(config.cwdApiKey, "en", nil),
+		meteo:    meteo,
 		storage:  storage,
+		clock:    appClock,
 		logLevel: loggingLevel,
 		logger: log.New(logFile, "ccAlgorithm: ",
 			log.Ldate|log.Ltime|log.Lshortfile),
@@ -0,0 +1,18 @@
+#!/bin/sh
+# Convert township boundaries of the Ministry of the Interior (TOWN_MOI) to
+# the simplified GeoJSON of offline reverse geocoding, config/townMoi.geojson
+# The shapefile is "鄉鎮市區界線(TWD97經緯度)" on https://data.gov.tw/dataset/7441
+# usage: config/townMoi.sh TOWN_MOI_xxxxxxx.shp
+# it needs mapshaper, npm install -g mapshaper
+set -e
+
+if [ -z "$1" ]; then
+	echo "usage: $0 TOWN_MOI_xxxxxxx.shp" >&2
+	exit 1
+fi
+
+mapshaper "$1" encoding=utf8 \
+	-proj wgs84 \
+	-simplify 5% keep-shapes \
+	-filter-fields COUNTYNAME,COUNTYENG,TOWNNAME,TOWNENG,TOWNCODE \
+	-o format=geojson precision=0.0001 "$(dirname "$0")/townMoi.geojson"
@@ -0,0 +1,236 @@
+/****************************************************************************
+ * This file is cache of reverse geocoding.                                 *
+ * Coordinates are quantised by grid cell, so users nearby share the answer *
+ ****************************************************************************/
+package geocoding
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+/**
+ * Default configuration of address cache
+ */
+const (
+	GEOCODE_CACHE_CELL = 0.0005 // degrees of grid cell, about 55 meters in Taiwan
+	GEOCODE_CACHE_SIZE = 1000   // addresses kept in memory
+	GEOCODE_CACHE_TTL  = 24 * time.Hour
+)
+
+/**
+ * Address of one grid cell stored by the backend
+ */
+type CacheRecord struct {
+	Key      string    `json:"key" bson:"key"` // language and grid cell e.g. en:50067:243129
+	Address  Address   `json:"address" bson:"address"`
+	ExpireAt time.Time `json:"expireAt" bson:"expireAt"`
+}
+
+/**
+ * Interface of persistent backend of address cache,
+ * the context is of the lookup so the backend should give up when it is done
+ */
+type CacheBackend interface {
+	Load(context.Context, string) (*CacheRecord, error) // nil record if the key is absent
+	Store(context.Context, CacheRecord) error
+}
+
+/**
+ * Counters of address cache, misses are the lookups which go past the cache
+ * to the geocoding sources e.g. offline boundaries then google
+ */
+type CacheStats struct {
+	Hits        int64 `json:"hits"`        // answered from memory
+	BackendHits int64 `json:"backendHits"` // answered from backend
+	Misses      int64 `json:"misses"`      // answered by geocoding sources
+	Evictions   int64 `json:"evictions"`   // dropped by the size bound
+	Size        int   `json:"size"`
+}
+
+/**
+ * @name HitRate
+ * @brief Get the ratio of lookups which are answered by the cache
+ * @return float64 The ratio from 0 to 1, 0 if there is no lookup
+ */
+func (stats CacheStats) HitRate() float64 {
+	total := stats.Hits + stats.BackendHits + stats.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(stats.Hits+stats.BackendHits) / float64(total)
+}
+
+type cacheEntry struct {
+	key      string
+	address  Address
+	expireAt time.Time
+}
+
+/**
+ * LRU cache of addresses with TTL, it can be shared by geocode instances of every language
+ */
+type AddressCache struct {
+	mutex   sync.Mutex
+	size    int
+	ttl     time.Duration
+	cell    float64
+	backend CacheBackend
+	entries map[string]*list.Element
+	lru     *list.List // the most recently used is the front
+	stats   CacheStats
+	now     func() time.Time
+}
+
+/**
+ * @name keyOf
+ * @brief Get the key of grid cell which contains the location
+ * @param language The language of address
+ * @param lat Latitude
+ * @param lng Longtitude
+ * @return string The key
+ */
+func (cache *AddressCache) keyOf(language string, lat float64, lng float64) string {
+	return fmt.Sprintf("%s:%d:%d", language, int64(math.Floor(lat/cache.cell)), int64(math.Floor(lng/cache.cell)))
+}
+
+/**
+ * Add the address to memory, the least recently used one is dropped if the cache is full
+ */
+func (cache *AddressCache) add(key string, address Address, expireAt time.Time) {
+
+	if element, ok := cache.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		entry.address = address
+		entry.expireAt = expireAt
+		cache.lru.MoveToFront(element)
+		return
+	}
+
+	cache.entries[key] = cache.lru.PushFront(&cacheEntry{key: key, address: address, expireAt: expireAt})
+
+	for cache.lru.Len() > cache.size {
+		oldest := cache.lru.Back()
+		cache.lru.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*cacheEntry).key)
+		cache.stats.Evictions++
+	}
+}
+
+/**
+ * @name get
+ * @brief Get the address of the key from memory, then from backend
+ * @param ctx The context of lookup, backend is skipped once it is done
+ * @param key The key of grid cell
+ * @return *Address The copy of address, nil if it is a miss
+ */
+func (cache *AddressCache) get(ctx context.Context, key string) *Address {
+
+	cache.mutex.Lock()
+	now := cache.now()
+	if element, ok := cache.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		if now.Before(entry.expireAt) {
+			cache.lru.MoveToFront(element)
+			cache.stats.Hits++
+			address := entry.address
+			cache.mutex.Unlock()
+			return &address
+		}
+		cache.lru.Remove(element)
+		delete(cache.entries, key)
+	}
+	cache.mutex.Unlock()
+
+	// the backend is slow, so it is not locked
+	if cache.backend != nil && ctx.Err() == nil {
+		if record, err := cache.backend.Load(ctx, key); err == nil && record != nil && now.Before(record.ExpireAt) {
+			cache.mutex.Lock()
+			cache.add(key, record.Address, record.ExpireAt)
+			cache.stats.BackendHits++
+			cache.mutex.Unlock()
+			address := record.Address
+			return &address
+		}
+	}
+
+	cache.mutex.Lock()
+	cache.stats.Misses++
+	cache.mutex.Unlock()
+
+	return nil
+}
+
+/**
+ * @name put
+ * @brief Store the address of the key in memory and backend,
+ * failure of backend does not fail the lookup
+ * @param ctx The context of lookup, backend is skipped once it is done
+ * @param key The key of grid cell
+ * @param address The address
+ */
+func (cache *AddressCache) put(ctx context.Context, key string, address Address) {
+
+	cache.mutex.Lock()
+	expireAt := cache.now().Add(cache.ttl)
+	cache.add(key, address, expireAt)
+	cache.mutex.Unlock()
+
+	if cache.backend != nil && ctx.Err() == nil {
+		cache.backend.Store(ctx, CacheRecord{Key: key, Address: address, ExpireAt: expireAt})
+	}
+}
+
+/**
+ * @name Stats
+ * @brief Get the counters of cache
+ * @return CacheStats The counters
+ */
+func (cache *AddressCache) Stats() CacheStats {
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	stats := cache.stats
+	stats.Size = cache.lru.Len()
+
+	return stats
+}
+
+/**
+ * @name NewAddressCache
+ * @brief Create an address cache, zero to use the default configuration
+ * @param size The number of addresses kept in memory
+ * @param ttl The time to live of address
+ * @param cell The degrees of grid cell, locations in the same cell share the address
+ * @param backend The persistent backend, nil to keep addresses in memory only
+ * @return *AddressCache The cache
+ */
+func NewAddressCache(size int, ttl time.Duration, cell float64, backend CacheBackend) *AddressCache {
+
+	if size <= 0 {
+		size = GEOCODE_CACHE_SIZE
+	}
+	if ttl <= 0 {
+		ttl = GEOCODE_CACHE_TTL
+	}
+	if cell <= 0 {
+		cell = GEOCODE_CACHE_CELL
+	}
+
+	cache := AddressCache{
+		size:    size,
+		ttl:     ttl,
+		cell:    cell,
+		backend: backend,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		now:     time.Now,
+	}
+
+	return &cache
+}
@@ -0,0 +1,321 @@
+/****************************************************************************
+ * This file is offline reverse geocoding by administrative boundaries.     *
+ * The boundaries are GeoJSON of township boundaries from the Ministry of   *
+ * the Interior (TOWN_MOI), whose names are the same as in CWB datasets.    *
+ ****************************************************************************/
+package geocoding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"sync"
+)
+
+/**
+ * Degrees of cell of the spatial index of boundaries
+ */
+const BOUNDARY_INDEX_CELL = 0.05
+
+/**
+ * The GeoJSON structure of township boundaries
+ * The example is testCase/taiwanBoundarySample.geojson
+ */
+type boundaryCollection struct {
+	Features []boundaryFeature `json:"features"`
+}
+
+type boundaryFeature struct {
+	Properties struct {
+		CountyName string `json:"COUNTYNAME"` // e.g. 臺北市
+		CountyEng  string `json:"COUNTYENG"`  // e.g. Taipei City
+		TownName   string `json:"TOWNNAME"`   // e.g. 信義區
+		TownEng    string `json:"TOWNENG"`    // e.g. Xinyi District
+		TownCode   string `json:"TOWNCODE"`
+	} `json:"properties"`
+	Geometry struct {
+		Type        string          `json:"type"` // Polygon or MultiPolygon
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+/**
+ * Polygon of GeoJSON, the first ring is the outer boundary and the others are holes
+ * A point of ring is [longtitude, latitude].
+ */
+type boundaryPolygon [][][2]float64
+
+/**
+ * Township with its polygons and bounding box
+ */
+type township struct {
+	countyZh string
+	countyEn string
+	townZh   string
+	townEn   string
+	code     string
+	polygons []boundaryPolygon
+	minLat   float64
+	minLng   float64
+	maxLat   float64
+	maxLng   float64
+}
+
+/**
+ * Spatial index of townships, a grid cell lists townships whose bounding box overlaps it
+ */
+type boundaryIndex struct {
+	townships []township
+	cells     map[[2]int][]int
+}
+
+/**
+ * Boundary files are parsed once and shared by geocode instances of every language
+ */
+var sharedBoundaries = struct {
+	mutex   sync.Mutex
+	indexes map[string]*boundaryIndex
+}{indexes: map[string]*boundaryIndex{}}
+
+/**
+ * @name contains
+ * @brief Check if the point is in the polygon by ray casting, a point in a hole is outside
+ * @param lat Latitude
+ * @param lng Longtitude
+ * @return bool True if the point is inside
+ */
+func (polygon boundaryPolygon) contains(lat float64, lng float64) bool {
+
+	inside := false
+	for index, ring := range polygon {
+		if ringContains(ring, lat, lng) {
+			if index > 0 {
+				return false
+			}
+			inside = true
+		} else if index == 0 {
+			return false
+		}
+	}
+
+	return inside
+}
+
+func ringContains(ring [][2]float64, lat float64, lng float64) bool {
+
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lng < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+func cellOf(lat float64, lng float64) [2]int {
+	return [2]int{int(math.Floor(lat / BOUNDARY_INDEX_CELL)), int(math.Floor(lng / BOUNDARY_INDEX_CELL))}
+}
+
+/**
+ * @name find
+ * @brief Find the township which contains the point
+ * @param lat Latitude
+ * @param lng Longtitude
+ * @return *township The township, nil if the point is out of every boundary
+ */
+func (index *boundaryIndex) find(lat float64, lng float64) *township {
+
+	for _, i := range index.cells[cellOf(lat, lng)] {
+		town := &index.townships[i]
+		if lat < town.minLat || lat > town.maxLat || lng < town.minLng || lng > town.maxLng {
+			continue
+		}
+		for _, polygon := range town.polygons {
+			if polygon.contains(lat, lng) {
+				return town
+			}
+		}
+	}
+
+	return nil
+}
+
+/**
+ * @name parseBoundaries
+ * @brief Parse GeoJSON of township boundaries and build the spatial index
+ * @param raw The GeoJSON
+ * @return *boundaryIndex The index
+ * @return error Error description, this will be nil if no error occurs
+ */
+func parseBoundaries(raw []byte) (*boundaryIndex, error) {
+
+	collection := boundaryCollection{}
+	if err := json.Unmarshal(raw, &collection); err != nil {
+		return nil, err
+	}
+
+	index := boundaryIndex{cells: map[[2]int][]int{}}
+	for _, feature := range collection.Features {
+		polygons := []boundaryPolygon{}
+		switch feature.Geometry.Type {
+		case "Polygon":
+			polygon := boundaryPolygon{}
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &polygon); err != nil {
+				return nil, err
+			}
+			polygons = append(polygons, polygon)
+		case "MultiPolygon":
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &polygons); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported boundary geometry: %s", feature.Geometry.Type)
+		}
+
+		properties := feature.Properties
+		town := township{
+			countyZh: properties.CountyName,
+			countyEn: properties.CountyEng,
+			townZh:   properties.TownName,
+			townEn:   properties.TownEng,
+			code:     properties.TownCode,
+			polygons: polygons,
+			minLat:   math.Inf(1),
+			minLng:   math.Inf(1),
+			maxLat:   math.Inf(-1),
+			maxLng:   math.Inf(-1),
+		}
+		for _, polygon := range polygons {
+			if len(polygon) == 0 {
+				continue
+			}
+			for _, point := range polygon[0] {
+				town.minLng = math.Min(town.minLng, point[0])
+				town.maxLng = math.Max(town.maxLng, point[0])
+				town.minLat = math.Min(town.minLat, point[1])
+				town.maxLat = math.Max(town.maxLat, point[1])
+			}
+		}
+		if town.countyZh == "" || math.IsInf(town.minLat, 0) {
+			continue
+		}
+
+		index.townships = append(index.townships, town)
+		low, high := cellOf(town.minLat, town.minLng), cellOf(town.maxLat, town.maxLng)
+		for y := low[0]; y <= high[0]; y++ {
+			for x := low[1]; x <= high[1]; x++ {
+				index.cells[[2]int{y, x}] = append(index.cells[[2]int{y, x}], len(index.townships)-1)
+			}
+		}
+	}
+	if len(index.townships) == 0 {
+		return nil, errors.New("no township in boundary file")
+	}
+
+	return &index, nil
+}
+
+/**
+ * @name loadBoundaries
+ * @brief Get the index of boundary file, the file is parsed at the first call
+ * @param path The GeoJSON file
+ * @return *boundaryIndex The index
+ * @return error Error description, this will be nil if no error occurs
+ */
+func loadBoundaries(path string) (*boundaryIndex, error) {
+
+	sharedBoundaries.mutex.Lock()
+	defer sharedBoundaries.mutex.Unlock()
+
+	if index, ok := sharedBoundaries.indexes[path]; ok {
+		return index, nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	index, err := parseBoundaries(raw)
+	if err != nil {
+		return nil, err
+	}
+	sharedBoundaries.indexes[path] = index
+
+	return index, nil
+}
+
+/**
+ * Class of offline reverse geocoding, it knows county and township only
+ */
+type boundaryGeo struct {
+	index    *boundaryIndex
+	language string
+}
+
+/**
+ * Find the township at latitude and longtitude, names are in Chinese if language is zh
+ */
+func (geo *boundaryGeo) reverseGeocode(ctx context.Context, lat float64, lng float64) ([]geocodeResult, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	town := geo.index.find(lat, lng)
+	if town == nil {
+		return nil, errors.New("Get zero location result")
+	}
+
+	county, name, formatted := town.countyEn, town.townEn, town.townEn+", "+town.countyEn+", Taiwan"
+	if strings.HasPrefix(geo.language, "zh") || county == "" || name == "" {
+		county, name, formatted = town.countyZh, town.townZh, "臺灣"+town.countyZh+town.townZh
+	}
+
+	result := geocodeResult{
+		components: []addressComponent{
+			addressComponent{LongName: name, ShortName: name, Types: []string{"administrative_area_level_3", "political"}},
+			addressComponent{LongName: county, ShortName: county, Types: []string{"administrative_area_level_1", "political"}},
+			addressComponent{LongName: "Taiwan", ShortName: GEOCODE_REGION_CODE, Types: []string{"country", "political"}},
+		},
+		formattedAddress: formatted,
+		lat:              lat,
+		lng:              lng,
+		locationType:     "APPROXIMATE",
+		types:            []string{"administrative_area_level_3", "political"},
+	}
+
+	return []geocodeResult{result}, nil
+}
+
+/**
+ * Forward geocoding needs google, the next source is tried
+ */
+func (geo *boundaryGeo) geocode(ctx context.Context, query string) ([]geocodeResult, error) {
+	return nil, errors.New("offline geocoding does not support address lookup")
+}
+
+/**
+ * Contructure of offline geocode class
+ * path is the GeoJSON file of township boundaries
+ */
+func newBoundaryGeo(path string, language string) (*boundaryGeo, error) {
+
+	index, err := loadBoundaries(path)
+	if err != nil {
+		return nil, err
+	}
+
+	geo := boundaryGeo{
+		index:    index,
+		language: language,
+	}
+
+	return &geo, nil
+}
@@ -4,23 +4,360 @@
  ****************************************************************************/
 package geocoding
 
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * Forward geocoding is biased to Taiwan
+ */
+const (
+	GEOCODE_REGION      string = "tw" // ccTLD of region bias
+	GEOCODE_REGION_CODE string = "TW" // country code of candidates in region
+)
+
 /**
- * Interface of geocode api
+ * Deadline of a lookup without context
+ */
+const GEOCODE_TIMEOUT = 10 * time.Second
+
+/**
+ * Scores to rank candidates of forward geocoding
+ */
+const (
+	CANDIDATE_SCORE_ROOFTOP            = 40
+	CANDIDATE_SCORE_RANGE_INTERPOLATED = 30
+	CANDIDATE_SCORE_GEOMETRIC_CENTER   = 20
+	CANDIDATE_SCORE_APPROXIMATE        = 10
+	CANDIDATE_SCORE_LANDMARK           = 15  // point of interest, station, etc.
+	CANDIDATE_SCORE_IN_REGION          = 40  // the country is GEOCODE_REGION_CODE
+	CANDIDATE_SCORE_PARTIAL_MATCH      = -20 // google matches only part of the query
+)
+
+/**
+ * Interface of geocode api, every lookup returns its own results,
+ * so a handler holds no state of request and can be shared by goroutines
  */
 type googleMapGeocode interface {
-	request(float64, float64) error
-	getCity() (string, error)
+	reverseGeocode(context.Context, float64, float64) ([]geocodeResult, error)
+	geocode(context.Context, string) ([]geocodeResult, error)
+}
+
+/**
+ * One result of geocode api, it is shared by every geocode handler
+ */
+type geocodeResult struct {
+	components       []addressComponent
+	formattedAddress string
+	placeId          string
+	lat              float64
+	lng              float64
+	locationType     string
+	types            []string
+	partialMatch     bool
+}
+
+/**
+ * Address component of geocode result
+ */
+type addressComponent struct {
+	LongName  string   `json:"long_name"`
+	ShortName string   `json:"short_name"`
+	Types     []string `json:"types"`
+}
+
+/**
+ * Address of a location, every field is empty if google doesn't answer it
+ */
+type Address struct {
+	CountryCode      string `json:"countryCode" bson:"countryCode"` // ISO 3166-1 alpha-2 e.g. TW
+	County           string `json:"county" bson:"county"`           // county or city e.g. Taipei City
+	District         string `json:"district" bson:"district"`       // administrative_area_level_3 e.g. Xinyi District
+	Village          string `json:"village" bson:"village"`         // administrative_area_level_4 e.g. Xicun Village
+	PostalCode       string `json:"postalCode" bson:"postalCode"`
+	FormattedAddress string `json:"formattedAddress" bson:"formattedAddress"`
+	PlaceId          string `json:"placeId" bson:"placeId"`
+}
+
+/**
+ * Candidate location of forward geocoding
+ */
+type Candidate struct {
+	Lat          float64  `json:"lat" bson:"lat"`
+	Lng          float64  `json:"lng" bson:"lng"`
+	Address      Address  `json:"address" bson:"address"`
+	LocationType string   `json:"locationType" bson:"locationType"` // ROOFTOP, RANGE_INTERPOLATED, GEOMETRIC_CENTER or APPROXIMATE
+	Types        []string `json:"types" bson:"types"`               // e.g. street_address, transit_station
+	PartialMatch bool     `json:"partialMatch" bson:"partialMatch"`
+	Score        int      `json:"score" bson:"score"` // higher is better
+}
+
+var landmarkTypes = map[string]bool{
+	"point_of_interest":  true,
+	"establishment":      true,
+	"premise":            true,
+	"tourist_attraction": true,
+	"transit_station":    true,
+	"train_station":      true,
+	"subway_station":     true,
+	"bus_station":        true,
+}
+
+/**
+ * @name score
+ * @brief Score the candidate by precision, landmark and region
+ * @return int The score
+ */
+func (candidate *Candidate) score() int {
+
+	score := 0
+	switch candidate.LocationType {
+	case "ROOFTOP":
+		score += CANDIDATE_SCORE_ROOFTOP
+	case "RANGE_INTERPOLATED":
+		score += CANDIDATE_SCORE_RANGE_INTERPOLATED
+	case "GEOMETRIC_CENTER":
+		score += CANDIDATE_SCORE_GEOMETRIC_CENTER
+	default:
+		score += CANDIDATE_SCORE_APPROXIMATE
+	}
+
+	for _, t := range candidate.Types {
+		if landmarkTypes[t] {
+			score += CANDIDATE_SCORE_LANDMARK
+			break
+		}
+	}
+
+	if candidate.Address.CountryCode == GEOCODE_REGION_CODE {
+		score += CANDIDATE_SCORE_IN_REGION
+	}
+
+	if candidate.PartialMatch {
+		score += CANDIDATE_SCORE_PARTIAL_MATCH
+	}
+
+	return score
+}
+
+/**
+ * @name rankCandidates
+ * @brief Score candidates and sort them from the best, the order of google is kept on ties
+ * @param candidates The candidates
+ */
+func rankCandidates(candidates []Candidate) {
+
+	for index := range candidates {
+		candidates[index].Score = candidates[index].score()
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+}
+
+/**
+ * @name address
+ * @brief Build the address from components of geocode result
+ * County is the highest administrative area level, level 1 first then level 2 and 3.
+ * @return *Address The address
+ * @return error Error description, this will be nil if no error occurs
+ */
+func (result *geocodeResult) address() (*Address, error) {
+
+	if len(result.components) == 0 {
+		return nil, errors.New("Can not get related address information")
+	}
+
+	address := Address{
+		FormattedAddress: result.formattedAddress,
+		PlaceId:          result.placeId,
+	}
+
+	levels := map[string]string{}
+	for _, component := range result.components {
+		if len(component.Types) == 0 {
+			continue
+		}
+		switch component.Types[0] {
+		case "country":
+			address.CountryCode = component.ShortName
+		case "postal_code":
+			address.PostalCode = component.LongName
+		case "administrative_area_level_1", "administrative_area_level_2", "administrative_area_level_3", "administrative_area_level_4":
+			if _, ok := levels[component.Types[0]]; !ok {
+				levels[component.Types[0]] = component.LongName
+			}
+		}
+	}
+
+	for _, level := range []string{"administrative_area_level_1", "administrative_area_level_2", "administrative_area_level_3"} {
+		if name, ok := levels[level]; ok {
+			address.County = name
+			break
+		}
+	}
+	address.District = levels["administrative_area_level_3"]
+	address.Village = levels["administrative_area_level_4"]
+
+	return &address, nil
+}
+
+/**
+ * @name candidate
+ * @brief Build the candidate of forward geocoding from geocode result
+ * @return *Candidate The candidate without score
+ * @return error Error description, this will be nil if no error occurs
+ */
+func (result *geocodeResult) candidate() (*Candidate, error) {
+
+	address, err := result.address()
+	if err != nil {
+		return nil, err
+	}
+
+	candidate := Candidate{
+		Lat:          result.lat,
+		Lng:          result.lng,
+		Address:      *address,
+		LocationType: result.locationType,
+		Types:        result.types,
+		PartialMatch: result.partialMatch,
+	}
+
+	return &candidate, nil
 }
 
 type Geocode struct {
 	geoHandler   googleMapGeocode
 	googleApiKey string
 	language     string
+	timeout      time.Duration
+	cache        *AddressCache // nil if addresses are not cached
+}
+
+/**
+ * Context of a lookup without context, it is cancelled after timeout of the instance
+ */
+func (geo *Geocode) context() (context.Context, context.CancelFunc) {
+	if geo.timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), geo.timeout)
+}
+
+/**
+ * @name GetAddressByLatlng
+ * @brief Get address by latitude and longtitude, it fails after GEOCODE_TIMEOUT
+ * @param lat Latitude
+ * @param lng Longtitude
+ * @return *Address The address of the first result
+ * @return error Error description, this will be nil if no error occurs
+ */
+func (geo *Geocode) GetAddressByLatlng(lat float64, lng float64) (*Address, error) {
+
+	ctx, cancel := geo.context()
+	defer cancel()
+
+	return geo.GetAddressByLatlngContext(ctx, lat, lng)
+}
+
+/**
+ * @name GetAddressByLatlngContext
+ * @brief Get address by latitude and longtitude
+ * @param ctx The context to cancel the lookup or set its deadline
+ * @param lat Latitude
+ * @param lng Longtitude
+ * @return *Address The address of the first result
+ * @return error Error description, this will be nil if no error occurs
+ */
+func (geo *Geocode) GetAddressByLatlngContext(ctx context.Context, lat float64, lng float64) (*Address, error) {
+
+	key := ""
+	if geo.cache != nil {
+		key = geo.cache.keyOf(geo.language, lat, lng)
+		if address := geo.cache.get(ctx, key); address != nil {
+			return address, nil
+		}
+	}
+
+	results, err := geo.geoHandler.reverseGeocode(ctx, lat, lng)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, errors.New("Get zero location result")
+	}
+
+	address, err := results[0].address()
+	if err != nil {
+		return nil, err
+	}
+
+	if geo.cache != nil {
+		geo.cache.put(ctx, key, *address)
+	}
+
+	return address, nil
+}
+
+/**
+ * @name GetLatlngByAddress
+ * @brief Get candidate locations by address or landmark, it fails after GEOCODE_TIMEOUT
+ * @param query The address or landmark in any language
+ * @return []Candidate The candidates ranked from the best
+ * @return error Error description, this will be nil if no error occurs
+ */
+func (geo *Geocode) GetLatlngByAddress(query string) ([]Candidate, error) {
+
+	ctx, cancel := geo.context()
+	defer cancel()
+
+	return geo.GetLatlngByAddressContext(ctx, query)
+}
+
+/**
+ * @name GetLatlngByAddressContext
+ * @brief Get candidate locations by address or landmark e.g. 台北101, Songshan Station
+ * @param ctx The context to cancel the lookup or set its deadline
+ * @param query The address or landmark in any language
+ * @return []Candidate The candidates ranked from the best
+ * @return error Error description, this will be nil if no error occurs
+ */
+func (geo *Geocode) GetLatlngByAddressContext(ctx context.Context, query string) ([]Candidate, error) {
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.New("Invalid address")
+	}
+
+	results, err := geo.geoHandler.geocode(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []Candidate{}
+	for index := range results {
+		if candidate, err := results[index].candidate(); err == nil {
+			candidates = append(candidates, *candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("Can not find location of that address")
+	}
+
+	rankCandidates(candidates)
+
+	return candidates, nil
 }
 
 /**
  * @name GetCityByLatlng
- * @brief Get city name by latitude and longtitude
+ * @brief Get city name by latitude and longtitude, it fails after GEOCODE_TIMEOUT
  * @param lat Latitude
  * @param lng Longtitude
  * @return string City name
@@ -28,23 +365,82 @@ type Geocode struct {
  */
 func (geo *Geocode) GetCityByLatlng(lat float64, lng float64) (string, error) {
 
-	err := geo.geoHandler.request(lat, lng)
+	ctx, cancel := geo.context()
+	defer cancel()
+
+	return geo.GetCityByLatlngContext(ctx, lat, lng)
+}
+
+/**
+ * @name GetCityByLatlngContext
+ * @brief Get city name by latitude and longtitude
+ * @param ctx The context to cancel the lookup or set its deadline
+ * @param lat Latitude
+ * @param lng Longtitude
+ * @return string City name
+ * @return error Error description, this will be nil if no error occurs
+ */
+func (geo *Geocode) GetCityByLatlngContext(ctx context.Context, lat float64, lng float64) (string, error) {
+
+	address, err := geo.GetAddressByLatlngContext(ctx, lat, lng)
 	if err != nil {
 		return "", err
 	}
 
-	var city string = ""
-	city, err = geo.geoHandler.getCity()
+	if address.County == "" {
+		return "", errors.New("Can not find related city name")
+	}
+
+	return address.County, nil
+}
+
+/**
+ * @name GetDistrictByLatlng
+ * @brief Get city and district name by latitude and longtitude, it fails after GEOCODE_TIMEOUT
+ * @param lat Latitude
+ * @param lng Longtitude
+ * @return string City name
+ * @return string District name (administrative_area_level_3)
+ * @return error Error description, this will be nil if no error occurs
+ */
+func (geo *Geocode) GetDistrictByLatlng(lat float64, lng float64) (string, string, error) {
+
+	ctx, cancel := geo.context()
+	defer cancel()
+
+	return geo.GetDistrictByLatlngContext(ctx, lat, lng)
+}
+
+/**
+ * @name GetDistrictByLatlngContext
+ * @brief Get city and district name by latitude and longtitude
+ * @param ctx The context to cancel the lookup or set its deadline
+ * @param lat Latitude
+ * @param lng Longtitude
+ * @return string City name
+ * @return string District name (administrative_area_level_3)
+ * @return error Error description, this will be nil if no error occurs
+ */
+func (geo *Geocode) GetDistrictByLatlngContext(ctx context.Context, lat float64, lng float64) (string, string, error) {
+
+	address, err := geo.GetAddressByLatlngContext(ctx, lat, lng)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return city, nil
+	if address.County == "" {
+		return "", "", errors.New("Can not find related city name")
+	}
+	if address.District == "" {
+		return "", "", errors.New("Can not find related district name")
+	}
+
+	return address.County, address.District, nil
 }
 
 /**
  * @name NewGeoCode
- * @brief Create a geocode instance
+ * @brief Create a geocode instance, it can be shared by goroutines
  * @param googleApiKey google map api key
  * @param language language e.g. en, zh-TW
  * @return Geocode instance
@@ -52,10 +448,28 @@ func (geo *Geocode) GetCityByLatlng(lat float64, lng float64) (string, error) {
 func NewGeocode(googleApiKey string, language string) *Geocode {
 
 	geo := Geocode{
-		geoHandler:   newMapGeo(googleApiKey, language),
+		geoHandler:   newMapGeo(googleApiKey, language, ""),
 		googleApiKey: googleApiKey,
 		language:     language,
+		timeout:      GEOCODE_TIMEOUT,
 	}
 
 	return &geo
 }
+
+/**
+ * @name NewCachedGeocode
+ * @brief Create a geocode instance whose reverse geocoding is cached,
+ * locations in the same grid cell of cache share one address
+ * @param googleApiKey google map api key
+ * @param language language e.g. en, zh-TW
+ * @param cache The address cache, it can be shared by instances of every language
+ * @return Geocode instance
+ */
+func NewCachedGeocode(googleApiKey string, language string, cache *AddressCache) *Geocode {
+
+	geo := NewGeocode(googleApiKey, language)
+	geo.cache = cache
+
+	return geo
+}
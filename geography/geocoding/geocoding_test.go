@@ -5,11 +5,23 @@
 package geocoding
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
+	"github.com/xu354cjo1008/eatingFinder/meteorology"
 )
 
 type locationTestCase struct {
@@ -77,3 +89,628 @@ func TestLocation(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+/**
+ * Stand-in google geocode server which responds the json in testCase folder
+ * Reverse geocoding is answered by the nearest fixture, address "slow" never answers.
+ */
+func newGeocodeTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(geocodeTestHandler(t))
+}
+
+func geocodeTestHandler(t *testing.T) http.Handler {
+
+	reverse := []struct {
+		lat  float64
+		lng  float64
+		file string
+	}{
+		{25.0336, 121.5648, "googleGeocodeTaipei101.json"},
+		{24.7441, 121.7633, "googleGeocodeYilan.json"},
+	}
+	forward := map[string]string{
+		"Songshan Station": "googleGeocodeSongshanStation.json",
+		"台北101":            "googleGeocodeTaipei101ZhTw.json",
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != GOOGLE_GEOCODE_PATH || query.Get("key") != "key" {
+			fmt.Fprint(rw, `{"results":[],"status":"REQUEST_DENIED","error_message":"The provided API key is invalid."}`)
+			return
+		}
+
+		file := ""
+		if latlng := strings.Split(query.Get("latlng"), ","); len(latlng) == 2 {
+			lat, _ := strconv.ParseFloat(latlng[0], 64)
+			lng, _ := strconv.ParseFloat(latlng[1], 64)
+			for _, fixture := range reverse {
+				if math.Abs(lat-fixture.lat) < 0.01 && math.Abs(lng-fixture.lng) < 0.01 {
+					file = fixture.file
+				}
+			}
+		} else if query.Get("address") == "slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		} else if query.Get("region") == GEOCODE_REGION {
+			file = forward[query.Get("address")]
+		}
+
+		if file == "" {
+			fmt.Fprint(rw, `{"results":[],"status":"ZERO_RESULTS"}`)
+			return
+		}
+		raw, err := ioutil.ReadFile("../../testCase/" + file)
+		if err != nil {
+			t.Error(err)
+		}
+		rw.Write(raw)
+	})
+}
+
+/**
+ * Every geocode handler with the stand-in server, one instance of each is shared by goroutines
+ */
+func geocodesOfTestServer(baseUrl string) map[string]*Geocode {
+	return map[string]*Geocode{
+		"directGeo": &Geocode{geoHandler: newDirectGeo("key", "en", baseUrl), timeout: GEOCODE_TIMEOUT},
+		"mapGeo":    &Geocode{geoHandler: newMapGeo("key", "en", baseUrl), timeout: GEOCODE_TIMEOUT},
+	}
+}
+
+type addressTestCase struct {
+	lat    float64
+	lng    float64
+	expect Address
+}
+
+/**
+ * Test job for address of reverse geocoding, both handlers parse the same response
+ * Input: latitude, longtitude
+ * Output: expected address
+ */
+func TestAddress(t *testing.T) {
+
+	server := newGeocodeTestServer(t)
+	defer server.Close()
+
+	testCases := []addressTestCase{
+		addressTestCase{lat: 25.0336, lng: 121.5648, expect: Address{
+			CountryCode:      "TW",
+			County:           "Taipei City",
+			District:         "Xinyi District",
+			Village:          "Xicun Village",
+			PostalCode:       "110",
+			FormattedAddress: "No. 7, Section 5, Xinyi Road, Xinyi District, Taipei City, Taiwan 110",
+			PlaceId:          "ChIJ_testCase_Taipei101",
+		}},
+		// county at administrative area level 2
+		addressTestCase{lat: 24.744071, lng: 121.763291, expect: Address{
+			CountryCode:      "TW",
+			County:           "Yilan County",
+			District:         "Yilan City",
+			PostalCode:       "260",
+			FormattedAddress: "Yilan City, Yilan County, Taiwan 260",
+			PlaceId:          "ChIJ_testCase_Yilan",
+		}},
+	}
+
+	for name, geocode := range geocodesOfTestServer(server.URL) {
+		for index, testCase := range testCases {
+			address, err := geocode.GetAddressByLatlng(testCase.lat, testCase.lng)
+			if err != nil || *address != testCase.expect {
+				t.Error("#", index, name, "Expected", testCase.expect, "Got", address, err, "Failed")
+			}
+			city, district, err := geocode.GetDistrictByLatlng(testCase.lat, testCase.lng)
+			if err != nil || city != testCase.expect.County || district != testCase.expect.District {
+				t.Error("#", index, name, "Expected", testCase.expect.County, testCase.expect.District, "Got", city, district, err, "Failed")
+			}
+		}
+
+		// in the sea
+		if _, err := geocode.GetCityByLatlng(22.0, 118.0); err == nil {
+			t.Error(name, "Expected error for zero results", "Failed")
+		}
+	}
+
+	invalid := geocodesOfTestServer(server.URL)
+	invalid["directGeo"].geoHandler = newDirectGeo("wrong", "en", server.URL)
+	invalid["mapGeo"].geoHandler = newMapGeo("wrong", "en", server.URL)
+	for name, geocode := range invalid {
+		if _, err := geocode.GetCityByLatlng(25.0336, 121.5648); err == nil {
+			t.Error(name, "Expected error for invalid api key", "Failed")
+		}
+	}
+	if _, err := NewGeocode("", "en").GetCityByLatlng(25.0336, 121.5648); err == nil {
+		t.Error("Expected error for empty api key", "Failed")
+	}
+}
+
+type candidateTestCase struct {
+	query    string
+	placeIds []string // ranked from the best
+	scores   []int
+	county   string
+}
+
+/**
+ * Test job for forward geocoding and ranking of candidates
+ * Input: address or landmark
+ * Output: expected ranking of candidates
+ */
+func TestLatlngByAddress(t *testing.T) {
+
+	server := newGeocodeTestServer(t)
+	defer server.Close()
+
+	testCases := []candidateTestCase{
+		// the station is better than the partial match and the mountain in China
+		candidateTestCase{
+			query:    "Songshan Station",
+			placeIds: []string{"ChIJ_testCase_SongshanStation", "ChIJ_testCase_SongshanDistrict", "ChIJ_testCase_SongshanHenan"},
+			scores:   []int{75, 30, 25},
+			county:   "Taipei City",
+		},
+		candidateTestCase{
+			query:    " 台北101 ",
+			placeIds: []string{"ChIJ_testCase_Taipei101"},
+			scores:   []int{95},
+			county:   "台北市",
+		},
+	}
+
+	for name, geocode := range geocodesOfTestServer(server.URL) {
+		for index, testCase := range testCases {
+			candidates, err := geocode.GetLatlngByAddress(testCase.query)
+			if err != nil || len(candidates) != len(testCase.placeIds) {
+				t.Error("#", index, name, "Expected", testCase.placeIds, "Got", candidates, err, "Failed")
+				continue
+			}
+			for i, candidate := range candidates {
+				if candidate.Address.PlaceId != testCase.placeIds[i] || candidate.Score != testCase.scores[i] {
+					t.Error("#", index, name, "rank", i, "Expected", testCase.placeIds[i], testCase.scores[i], "Got", candidate.Address.PlaceId, candidate.Score, "Failed")
+				}
+			}
+			if candidates[0].Address.County != testCase.county || candidates[0].Lat == 0 || candidates[0].Lng == 0 {
+				t.Error("#", index, name, "Expected location in", testCase.county, "Got", candidates[0], "Failed")
+			}
+		}
+
+		if _, err := geocode.GetLatlngByAddress("  "); err == nil {
+			t.Error(name, "Expected error for empty address", "Failed")
+		}
+		if _, err := geocode.GetLatlngByAddress("Atlantis"); err == nil {
+			t.Error(name, "Expected error for zero results", "Failed")
+		}
+	}
+}
+
+/**
+ * Test job for one geocode instance shared by goroutines, run with -race
+ * Input: lookups of different locations at the same time
+ * Output: every lookup gets its own result
+ */
+func TestConcurrentGeocode(t *testing.T) {
+
+	server := newGeocodeTestServer(t)
+	defer server.Close()
+
+	expects := []locationTestCase{
+		locationTestCase{lat: 25.0336, lng: 121.5648, expect: "Taipei City"},
+		locationTestCase{lat: 24.7441, lng: 121.7633, expect: "Yilan County"},
+	}
+
+	for name, geocode := range geocodesOfTestServer(server.URL) {
+		var wg sync.WaitGroup
+		for index := 0; index < 20; index++ {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				testCase := expects[index%len(expects)]
+				if index%5 == 4 {
+					candidates, err := geocode.GetLatlngByAddress("Songshan Station")
+					if err != nil || candidates[0].Address.PlaceId != "ChIJ_testCase_SongshanStation" {
+						t.Error("#", index, name, "Expected Songshan Station", "Got", candidates, err, "Failed")
+					}
+					return
+				}
+				if res, err := geocode.GetCityByLatlng(testCase.lat, testCase.lng); res != testCase.expect || err != nil {
+					t.Error("#", index, name, "Expected", testCase.expect, "Got", res, err, "Failed")
+				}
+			}(index)
+		}
+		wg.Wait()
+	}
+}
+
+/**
+ * Test job for cancellation and deadline of lookups
+ * Input: lookup which the server never answers
+ * Output: error as soon as the context is done
+ */
+func TestGeocodeDeadline(t *testing.T) {
+
+	server := newGeocodeTestServer(t)
+	defer server.Close()
+
+	for name, geocode := range geocodesOfTestServer(server.URL) {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err := geocode.GetLatlngByAddressContext(ctx, "slow")
+		cancel()
+		if err == nil || time.Since(start) > 2*time.Second {
+			t.Error(name, "Expected error by deadline", "Got", err, time.Since(start), "Failed")
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		if _, err := geocode.GetCityByLatlngContext(ctx, 25.0336, 121.5648); err == nil {
+			t.Error(name, "Expected error for cancelled context", "Failed")
+		}
+
+		// lookups without context use the timeout of instance
+		geocode.timeout = 50 * time.Millisecond
+		start = time.Now()
+		if _, err := geocode.GetLatlngByAddress("slow"); err == nil || time.Since(start) > 2*time.Second {
+			t.Error(name, "Expected error by timeout", "Got", err, time.Since(start), "Failed")
+		}
+	}
+}
+
+/**
+ * Stand-in persistent backend of address cache
+ */
+type memCacheBackend struct {
+	mutex   sync.Mutex
+	records map[string]CacheRecord
+	loads   int
+	err     error // every call fails if it is set
+}
+
+func (backend *memCacheBackend) Load(ctx context.Context, key string) (*CacheRecord, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	backend.loads++
+	if backend.err != nil {
+		return nil, backend.err
+	}
+	if record, ok := backend.records[key]; ok {
+		return &record, nil
+	}
+	return nil, nil
+}
+
+func (backend *memCacheBackend) Store(ctx context.Context, record CacheRecord) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	if backend.err != nil {
+		return backend.err
+	}
+	backend.records[record.Key] = record
+	return nil
+}
+
+type cacheTestCase struct {
+	lat      float64
+	lng      float64
+	language string
+	after    time.Duration // time passed since the first lookup
+	expect   CacheStats    // counters after the lookup
+}
+
+/**
+ * Test job for quantised address cache with TTL and LRU bound
+ * Input: lookups of locations, languages and time
+ * Output: expected hits, misses and evictions, misses are the requests to server
+ */
+func TestGeocodeCache(t *testing.T) {
+
+	var requests int64
+	handler := geocodeTestHandler(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		handler.ServeHTTP(rw, r)
+	}))
+	defer server.Close()
+
+	start := time.Date(2016, 9, 9, 12, 0, 0, 0, time.UTC)
+	backend := &memCacheBackend{records: map[string]CacheRecord{}}
+	cache := NewAddressCache(2, time.Hour, 0, backend)
+	geocodes := map[string]*Geocode{}
+	for _, language := range []string{"en", "zh-TW"} {
+		geocodes[language] = &Geocode{geoHandler: newDirectGeo("key", language, server.URL), language: language, timeout: GEOCODE_TIMEOUT, cache: cache}
+	}
+
+	testCases := []cacheTestCase{
+		cacheTestCase{lat: 25.0336, lng: 121.5648, language: "en", expect: CacheStats{Misses: 1, Size: 1}},
+		// the other side of the building is in the same cell
+		cacheTestCase{lat: 25.03364, lng: 121.56484, language: "en", expect: CacheStats{Hits: 1, Misses: 1, Size: 1}},
+		// the address in other language is not shared
+		cacheTestCase{lat: 25.0336, lng: 121.5648, language: "zh-TW", expect: CacheStats{Hits: 1, Misses: 2, Size: 2}},
+		// the first lookup is the least recently used
+		cacheTestCase{lat: 24.7441, lng: 121.7633, language: "en", expect: CacheStats{Hits: 1, Misses: 3, Evictions: 1, Size: 2}},
+		// the evicted address is still in backend
+		cacheTestCase{lat: 25.0336, lng: 121.5648, language: "en", expect: CacheStats{Hits: 1, BackendHits: 1, Misses: 3, Evictions: 2, Size: 2}},
+		cacheTestCase{lat: 24.7441, lng: 121.7633, language: "en", after: 30 * time.Minute, expect: CacheStats{Hits: 2, BackendHits: 1, Misses: 3, Evictions: 2, Size: 2}},
+		// expired in memory and backend
+		cacheTestCase{lat: 24.7441, lng: 121.7633, language: "en", after: 2 * time.Hour, expect: CacheStats{Hits: 2, BackendHits: 1, Misses: 4, Evictions: 2, Size: 2}},
+	}
+
+	for index, testCase := range testCases {
+		now := start.Add(testCase.after)
+		cache.now = func() time.Time { return now }
+		address, err := geocodes[testCase.language].GetAddressByLatlng(testCase.lat, testCase.lng)
+		if err != nil || address.PlaceId == "" {
+			t.Error("#", index, "Expected address", "Got", address, err, "Failed")
+		}
+		stats := cache.Stats()
+		if stats != testCase.expect || atomic.LoadInt64(&requests) != stats.Misses {
+			t.Error("#", index, "Expected", testCase.expect, "Got", stats, "requests", atomic.LoadInt64(&requests), "Failed")
+		}
+	}
+
+	// the address returned is a copy
+	address, _ := geocodes["en"].GetAddressByLatlng(24.7441, 121.7633)
+	address.County = "Atlantis"
+	if address, _ := geocodes["en"].GetAddressByLatlng(24.7441, 121.7633); address.County != "Yilan County" {
+		t.Error("Expected Yilan County", "Got", address.County, "Failed")
+	}
+
+	if rate := (CacheStats{Hits: 3, BackendHits: 1, Misses: 4}).HitRate(); rate != 0.5 {
+		t.Error("Expected hit rate 0.5", "Got", rate, "Failed")
+	}
+
+	// failed lookups are not cached
+	if _, err := geocodes["en"].GetAddressByLatlng(22.0, 118.0); err == nil {
+		t.Error("Expected error for zero results", "Failed")
+	}
+	if _, ok := backend.records[cache.keyOf("en", 22.0, 118.0)]; ok {
+		t.Error("Expected no record of zero results", "Failed")
+	}
+
+	// failure of backend does not fail the lookup
+	backend = &memCacheBackend{records: map[string]CacheRecord{}, err: errors.New("no reachable servers")}
+	geocode := &Geocode{geoHandler: newDirectGeo("key", "en", server.URL), language: "en", timeout: GEOCODE_TIMEOUT, cache: NewAddressCache(0, 0, 0, backend)}
+	if address, err := geocode.GetAddressByLatlng(25.0336, 121.5648); err != nil || address.County != "Taipei City" {
+		t.Error("Expected address without backend", "Got", address, err, "Failed")
+	}
+	// backend is skipped once the lookup is cancelled
+	loads := backend.loads
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := geocode.GetAddressByLatlngContext(ctx, 24.7441, 121.7633); err == nil || backend.loads != loads {
+		t.Error("Expected cancelled lookup without backend", "Got", err, backend.loads-loads, "loads", "Failed")
+	}
+
+	// one cache shared by goroutines, run with -race
+	cache = NewAddressCache(1, 0, 0, nil)
+	geocode = &Geocode{geoHandler: newDirectGeo("key", "en", server.URL), language: "en", timeout: GEOCODE_TIMEOUT, cache: cache}
+	var wg sync.WaitGroup
+	for index := 0; index < 20; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			testCase := testCases[index%2*3]
+			if _, err := geocode.GetAddressByLatlng(testCase.lat, testCase.lng); err != nil {
+				t.Error("#", index, "Expected address", "Got", err, "Failed")
+			}
+		}(index)
+	}
+	wg.Wait()
+	if stats := cache.Stats(); stats.Hits+stats.Misses != 20 || stats.Size != 1 {
+		t.Error("Expected 20 lookups", "Got", stats, "Failed")
+	}
+}
+
+type boundaryTestCase struct {
+	lat      float64
+	lng      float64
+	language string
+	county   string // empty if the location is out of every boundary
+	district string
+}
+
+/**
+ * Test job for offline reverse geocoding by township boundaries
+ * Input: latitude, longtitude and language
+ * Output: county and district named as in CWB datasets
+ */
+func TestBoundaryGeocode(t *testing.T) {
+
+	path := "../../testCase/taiwanBoundarySample.geojson"
+	cwb, err := ioutil.ReadFile("../../testCase/F-C0032-001.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []boundaryTestCase{
+		boundaryTestCase{lat: 25.0336, lng: 121.5648, language: "en", county: "Taipei City", district: "Xinyi District"},
+		boundaryTestCase{lat: 25.0336, lng: 121.5648, language: "zh-TW", county: "臺北市", district: "信義區"},
+		boundaryTestCase{lat: 25.06, lng: 121.57, language: "en", county: "Taipei City", district: "Songshan District"},
+		boundaryTestCase{lat: 24.744071, lng: 121.763291, language: "zh-TW", county: "宜蘭縣", district: "宜蘭市"},
+		// the other polygon of multipolygon
+		boundaryTestCase{lat: 24.705, lng: 121.805, language: "en", county: "Yilan County", district: "Yilan City"},
+		// in the hole
+		boundaryTestCase{lat: 24.75, lng: 121.757, language: "en"},
+		// in the sea
+		boundaryTestCase{lat: 22.0, lng: 118.0, language: "en"},
+	}
+
+	for index, testCase := range testCases {
+		geocode, err := NewGeocodeByConfig(Config{Language: testCase.language, Sources: []string{GEOCODE_SOURCE_BOUNDARY}, BoundaryFile: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		county, district, err := geocode.GetDistrictByLatlng(testCase.lat, testCase.lng)
+		if testCase.county == "" {
+			if err == nil {
+				t.Error("#", index, "Expected error out of boundaries", "Got", county, district, "Failed")
+			}
+			continue
+		}
+		if err != nil || county != testCase.county || district != testCase.district {
+			t.Error("#", index, "Expected", testCase.county, testCase.district, "Got", county, district, err, "Failed")
+		}
+		if strings.HasPrefix(testCase.language, "zh") && !strings.Contains(string(cwb), "<locationName>"+county+"</locationName>") {
+			t.Error("#", index, "Expected CWB location name", "Got", county, "Failed")
+		}
+	}
+
+	// a cell of the index lists nearby townships only
+	index, err := loadBoundaries(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if towns := index.cells[cellOf(25.0336, 121.5648)]; len(towns) == 0 || len(towns) >= len(index.townships) {
+		t.Error("Expected townships of Taipei in the cell", "Got", towns, "Failed")
+	}
+
+	if _, err := NewGeocodeByConfig(Config{Sources: []string{GEOCODE_SOURCE_BOUNDARY}, BoundaryFile: "notExist.geojson"}); err == nil {
+		t.Error("Expected error for missing boundary file", "Failed")
+	}
+	if _, err := NewGeocodeByConfig(Config{Sources: []string{"bing"}}); err == nil {
+		t.Error("Expected error for unknown source", "Failed")
+	}
+}
+
+/**
+ * Test job for boundaries as primary or fallback source of google
+ * Input: lookups in and out of the boundaries
+ * Output: the source which answers, google is requested only if boundaries can't answer
+ */
+func TestBoundaryFallback(t *testing.T) {
+
+	var requests int64
+	handler := geocodeTestHandler(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		handler.ServeHTTP(rw, r)
+	}))
+	defer server.Close()
+
+	boundary, err := newBoundaryGeo("../../testCase/taiwanBoundarySample.geojson", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// boundaries first
+	geocode := &Geocode{geoHandler: &fallbackGeo{providers: []geoProvider{
+		geoProvider{source: GEOCODE_SOURCE_BOUNDARY, handler: boundary},
+		geoProvider{source: GEOCODE_SOURCE_GOOGLE, handler: newDirectGeo("key", "en", server.URL)},
+	}}, timeout: GEOCODE_TIMEOUT}
+
+	address, err := geocode.GetAddressByLatlng(25.0336, 121.5648)
+	if err != nil || address.County != "Taipei City" || address.CountryCode != "TW" || address.PlaceId != "" || atomic.LoadInt64(&requests) != 0 {
+		t.Error("Expected offline address", "Got", address, err, "requests", atomic.LoadInt64(&requests), "Failed")
+	}
+	// the hole is answered by google
+	address, err = geocode.GetAddressByLatlng(24.75, 121.757)
+	if err != nil || address.PlaceId != "ChIJ_testCase_Yilan" || atomic.LoadInt64(&requests) != 1 {
+		t.Error("Expected google address", "Got", address, err, "requests", atomic.LoadInt64(&requests), "Failed")
+	}
+	candidates, err := geocode.GetLatlngByAddress("Songshan Station")
+	if err != nil || candidates[0].Address.PlaceId != "ChIJ_testCase_SongshanStation" {
+		t.Error("Expected forward geocoding by google", "Got", candidates, err, "Failed")
+	}
+	if _, err := geocode.GetCityByLatlng(22.0, 118.0); err == nil || !strings.Contains(err.Error(), GEOCODE_SOURCE_BOUNDARY) || !strings.Contains(err.Error(), GEOCODE_SOURCE_GOOGLE) {
+		t.Error("Expected errors of every source", "Got", err, "Failed")
+	}
+
+	// google first, it fails without valid key
+	geocode = &Geocode{geoHandler: &fallbackGeo{providers: []geoProvider{
+		geoProvider{source: GEOCODE_SOURCE_GOOGLE, handler: newDirectGeo("wrong", "en", server.URL)},
+		geoProvider{source: GEOCODE_SOURCE_BOUNDARY, handler: boundary},
+	}}, timeout: GEOCODE_TIMEOUT}
+	if city, err := geocode.GetCityByLatlng(24.744071, 121.763291); err != nil || city != "Yilan County" {
+		t.Error("Expected Yilan County", "Got", city, err, "Failed")
+	}
+
+	// a cancelled lookup doesn't fall through
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := geocode.GetCityByLatlngContext(ctx, 24.744071, 121.763291); err != context.Canceled {
+		t.Error("Expected context canceled", "Got", err, "Failed")
+	}
+}
+
+/**
+ * The boundaries made by config/townMoi.sh from TOWN_MOI
+ */
+const townMoiFile = "../../config/townMoi.geojson"
+
+/**
+ * Test job for names of boundaries
+ * Input: boundary files
+ * Output: every county is found by the county matcher of meteorology with the same names
+ */
+func TestBoundaryCountyNames(t *testing.T) {
+
+	paths := []string{"../../testCase/taiwanBoundarySample.geojson"}
+	if _, err := os.Stat(townMoiFile); err == nil {
+		paths = append(paths, townMoiFile)
+	}
+
+	for _, path := range paths {
+		index, err := loadBoundaries(path)
+		if err != nil {
+			t.Fatal(path, err)
+		}
+		for _, town := range index.townships {
+			if name, err := meteorology.CountyName(town.countyZh, "zh-TW"); err != nil || name != town.countyZh {
+				t.Error(path, town.code, "Expected", town.countyZh, "Got", name, err, "Failed")
+			}
+			if name, err := meteorology.CountyName(town.countyEn, "en"); err != nil || name != town.countyEn {
+				t.Error(path, town.code, "Expected", town.countyEn, "Got", name, err, "Failed")
+			}
+			if name, err := meteorology.CountyName(town.countyEn, "zh-TW"); err != nil || name != town.countyZh {
+				t.Error(path, town.code, "Expected", town.countyZh, "Got", name, err, "Failed")
+			}
+		}
+	}
+}
+
+/**
+ * Test job for offline reverse geocoding by real boundaries
+ * Input: latitude, longtitude and language of landmarks
+ * Output: county and district of TOWN_MOI
+ */
+func TestBoundaryTownMoi(t *testing.T) {
+
+	if _, err := os.Stat(townMoiFile); err != nil {
+		t.Skip("make config/townMoi.geojson by config/townMoi.sh to test real boundaries")
+	}
+
+	testCases := []boundaryTestCase{
+		// Taipei 101
+		boundaryTestCase{lat: 25.0339, lng: 121.5645, language: "zh-TW", county: "臺北市", district: "信義區"},
+		boundaryTestCase{lat: 25.0339, lng: 121.5645, language: "en", county: "Taipei City", district: "Xinyi District"},
+		// Yilan station
+		boundaryTestCase{lat: 24.7545, lng: 121.7580, language: "zh-TW", county: "宜蘭縣", district: "宜蘭市"},
+		// Cultural center of Kaohsiung
+		boundaryTestCase{lat: 22.6270, lng: 120.3172, language: "zh-TW", county: "高雄市", district: "苓雅區"},
+		// Kinmen county government
+		boundaryTestCase{lat: 24.4368, lng: 118.3186, language: "zh-TW", county: "金門縣", district: "金城鎮"},
+		// in the sea
+		boundaryTestCase{lat: 23.0, lng: 122.0, language: "en"},
+	}
+
+	for index, testCase := range testCases {
+		geocode, err := NewGeocodeByConfig(Config{Language: testCase.language, Sources: []string{GEOCODE_SOURCE_BOUNDARY}, BoundaryFile: townMoiFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		county, district, err := geocode.GetDistrictByLatlng(testCase.lat, testCase.lng)
+		if testCase.county == "" {
+			if err == nil {
+				t.Error("#", index, "Expected error out of boundaries", "Got", county, district, "Failed")
+			}
+			continue
+		}
+		if err != nil || county != testCase.county || district != testCase.district {
+			t.Error("#", index, "Expected", testCase.county, testCase.district, "Got", county, district, err, "Failed")
+		}
+	}
+}
@@ -5,112 +5,143 @@
 package geocoding
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"net/url"
 )
 
-const GOOGLE_GEOCODE_URL string = "https://maps.googleapis.com/maps/api/geocode/json?latlng=%f,%f&key=%s&language=%s"
+const (
+	GOOGLE_MAPS_HOST    string = "https://maps.googleapis.com"
+	GOOGLE_GEOCODE_PATH string = "/maps/api/geocode/json"
+)
 
 /**
  * Class to handle direct access google geocode api
  */
 type directGeo struct {
-	response     map[string]interface{}
+	client       *http.Client
+	baseUrl      string
 	googleApiKey string
 	language     string
 }
 
 /**
- * Request google geocode api and store response to struct
+ * The json structure of geocode api
+ * The example geocode results are in testCase folder e.g. googleGeocodeTaipei101.json
+ */
+type directResponse struct {
+	Status       string         `json:"status"`
+	ErrorMessage string         `json:"error_message"`
+	Results      []directResult `json:"results"`
+}
+
+type directResult struct {
+	AddressComponents []addressComponent `json:"address_components"`
+	FormattedAddress  string             `json:"formatted_address"`
+	PlaceId           string             `json:"place_id"`
+	Types             []string           `json:"types"`
+	PartialMatch      bool               `json:"partial_match"`
+	Geometry          struct {
+		Location struct {
+			Lat float64 `json:"lat"`
+			Lng float64 `json:"lng"`
+		} `json:"location"`
+		LocationType string `json:"location_type"`
+	} `json:"geometry"`
+}
+
+/**
+ * Request google geocode api and parse the results
  */
-func (geo *directGeo) request(lat float64, lng float64) error {
+func (geo *directGeo) fetch(ctx context.Context, params url.Values) ([]geocodeResult, error) {
 
 	if geo.googleApiKey == "" {
-		return errors.New("Invalid google api key")
+		return nil, errors.New("Invalid google api key")
 	}
 
-	reqUrl := fmt.Sprintf(GOOGLE_GEOCODE_URL, lat, lng, geo.googleApiKey, geo.language)
+	params.Set("key", geo.googleApiKey)
+	params.Set("language", geo.language)
 
-	resp, err := http.Get(reqUrl)
+	req, err := http.NewRequest("GET", geo.baseUrl+GOOGLE_GEOCODE_PATH+"?"+params.Encode(), nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	resp, err := geo.client.Do(req.WithContext(ctx))
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	var geoRes map[string]interface{}
-	if err := json.Unmarshal(body, &geoRes); err != nil {
-		return err
+	v := directResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, err
 	}
 
-	geo.response = geoRes
+	switch v.Status {
+	case "OK":
+	case "ZERO_RESULTS":
+		return nil, errors.New("Get zero location result")
+	default:
+		return nil, fmt.Errorf("Geocode api status: %s %s", v.Status, v.ErrorMessage)
+	}
 
-	return nil
+	results := []geocodeResult{}
+	for _, result := range v.Results {
+		results = append(results, geocodeResult{
+			components:       result.AddressComponents,
+			formattedAddress: result.FormattedAddress,
+			placeId:          result.PlaceId,
+			lat:              result.Geometry.Location.Lat,
+			lng:              result.Geometry.Location.Lng,
+			locationType:     result.Geometry.LocationType,
+			types:            result.Types,
+			partialMatch:     result.PartialMatch,
+		})
+	}
+
+	return results, nil
 }
 
 /**
- * Parse geocode api return result
- * The example geocode result is at geocodeReturnExample file
+ * Request google geocode api by latitude and longtitude
  */
-func (geo *directGeo) getCity() (string, error) {
+func (geo *directGeo) reverseGeocode(ctx context.Context, lat float64, lng float64) ([]geocodeResult, error) {
 
-	if geo.response == nil {
-		return "", errors.New("Can not get city from Invalid response context")
-	}
+	params := url.Values{}
+	params.Set("latlng", fmt.Sprintf("%f,%f", lat, lng))
 
-	result := geo.response["results"].([]interface{})
-	if len(result) == 0 {
-		return "", errors.New("Get zero location result")
-	}
-
-	address := result[0].(map[string]interface{})
-	if len(address) == 0 {
-		return "", errors.New("Can not get related address of that location")
-	}
-
-	components := address["address_components"].([]interface{})
-	if len(components) == 0 {
-		return "", errors.New("Can not get related data components of that address")
-	}
-
-	// Try to get city name with highest administrative area level
-	for _, component := range components {
-		types := component.(map[string]interface{})["types"].([]interface{})
-		if types[0] == "administrative_area_level_1" {
-			return component.(map[string]interface{})["long_name"].(string), nil
-		}
-	}
+	return geo.fetch(ctx, params)
+}
 
-	for _, component := range components {
-		types := component.(map[string]interface{})["types"].([]interface{})
-		if types[0] == "administrative_area_level_2" {
-			return component.(map[string]interface{})["long_name"].(string), nil
-		}
-	}
+/**
+ * Request google geocode api by address or landmark
+ */
+func (geo *directGeo) geocode(ctx context.Context, query string) ([]geocodeResult, error) {
 
-	for _, component := range components {
-		types := component.(map[string]interface{})["types"].([]interface{})
-		if types[0] == "administrative_area_level_3" {
-			return component.(map[string]interface{})["long_name"].(string), nil
-		}
-	}
+	params := url.Values{}
+	params.Set("address", query)
+	params.Set("region", GEOCODE_REGION)
 
-	return "", errors.New("Can not find related city name")
+	return geo.fetch(ctx, params)
 }
 
 /**
  * Contructure of direct geocode class
+ * baseUrl is the host of google maps api, empty to use GOOGLE_MAPS_HOST
  */
-func newDirectGeo(googleApiKey string, language string) *directGeo {
+func newDirectGeo(googleApiKey string, language string, baseUrl string) *directGeo {
+
+	if baseUrl == "" {
+		baseUrl = GOOGLE_MAPS_HOST
+	}
 
 	geo := directGeo{
+		client:       http.DefaultClient,
+		baseUrl:      baseUrl,
 		googleApiKey: googleApiKey,
 		language:     language,
 	}
@@ -6,91 +6,111 @@ package geocoding
 
 import (
 	"context"
-	"errors"
 
 	"googlemaps.github.io/maps"
 )
 
 /**
  * Class to handle google geocode api provide by https://github.com/googlemaps/google-maps-services-go
+ * maps.Client is safe for concurrent use
  */
 type mapGeo struct {
 	client   *maps.Client
-	response []maps.GeocodingResult
+	err      error // error to create client e.g. missing api key
 	language string
 }
 
 /**
- * Request google google map geocode api and store response to struct
+ * Convert googlemap.map geocode results
  */
-func (geo *mapGeo) request(lat float64, lng float64) error {
+func resultsOfMap(resp []maps.GeocodingResult) []geocodeResult {
+
+	results := []geocodeResult{}
+	for _, result := range resp {
+		components := []addressComponent{}
+		for _, component := range result.AddressComponents {
+			components = append(components, addressComponent{
+				LongName:  component.LongName,
+				ShortName: component.ShortName,
+				Types:     component.Types,
+			})
+		}
+		results = append(results, geocodeResult{
+			components:       components,
+			formattedAddress: result.FormattedAddress,
+			placeId:          result.PlaceID,
+			lat:              result.Geometry.Location.Lat,
+			lng:              result.Geometry.Location.Lng,
+			locationType:     result.Geometry.LocationType,
+			types:            result.Types,
+			partialMatch:     result.PartialMatch,
+		})
+	}
+
+	return results
+}
+
+/**
+ * Request google google map geocode api by latitude and longtitude
+ */
+func (geo *mapGeo) reverseGeocode(ctx context.Context, lat float64, lng float64) ([]geocodeResult, error) {
+
+	if geo.client == nil {
+		return nil, geo.err
+	}
 
 	req := &maps.GeocodingRequest{
 		LatLng:   &maps.LatLng{Lat: lat, Lng: lng},
 		Language: geo.language,
 	}
 
-	resp, err := geo.client.ReverseGeocode(context.Background(), req)
+	resp, err := geo.client.ReverseGeocode(ctx, req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	geo.response = resp
-
-	return nil
+	return resultsOfMap(resp), nil
 }
 
 /**
- * Parse googlemap.map geocode return result
+ * Request google google map geocode api by address or landmark
  */
-func (geo *mapGeo) getCity() (string, error) {
-
-	var components []maps.AddressComponent
-	if len(geo.response) == 0 {
-		return "", errors.New("Can not get related address of that location")
-	}
+func (geo *mapGeo) geocode(ctx context.Context, query string) ([]geocodeResult, error) {
 
-	components = geo.response[0].AddressComponents
-
-	if components == nil || len(components) == 0 {
-		return "", errors.New("Can not get related address information")
-	}
-
-	// Try to get city name with highest administrative area level
-	for _, component := range components {
-		if component.Types[0] == "administrative_area_level_1" {
-			return component.LongName, nil
-		}
+	if geo.client == nil {
+		return nil, geo.err
 	}
 
-	for _, component := range components {
-		if component.Types[0] == "administrative_area_level_2" {
-			return component.LongName, nil
-		}
+	req := &maps.GeocodingRequest{
+		Address:  query,
+		Language: geo.language,
+		Region:   GEOCODE_REGION,
 	}
 
-	for _, component := range components {
-		if component.Types[0] == "administrative_area_level_3" {
-			return component.LongName, nil
-		}
+	resp, err := geo.client.Geocode(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
-	return "", errors.New("Can not find related city name")
+	return resultsOfMap(resp), nil
 }
 
 /**
  * Contructure of https://github.com/googlemaps/google-maps-services-go geocode class
+ * baseUrl is the host of google maps api, empty to use the default one
  */
-func newMapGeo(googleApiKey string, language string) *mapGeo {
+func newMapGeo(googleApiKey string, language string, baseUrl string) *mapGeo {
 
-	client, err := maps.NewClient(maps.WithAPIKey(googleApiKey))
-
-	if err != nil {
-		return nil
+	options := []maps.ClientOption{maps.WithAPIKey(googleApiKey)}
+	if baseUrl != "" {
+		options = append(options, maps.WithBaseURL(baseUrl))
 	}
 
+	client, err := maps.NewClient(options...)
+
 	geo := mapGeo{
 		client:   client,
+		err:      err,
 		language: language,
 	}
 
@@ -0,0 +1,138 @@
+/****************************************************************************
+ * This file is the fallback chain of geocoding sources.                    *
+ * Sources are tried in order until one of them answers.                    *
+ ****************************************************************************/
+package geocoding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/**
+ * Sources of geocoding
+ */
+const (
+	GEOCODE_SOURCE_GOOGLE   string = "google"   // google geocode api
+	GEOCODE_SOURCE_BOUNDARY string = "boundary" // offline township boundaries, reverse geocoding only
+)
+
+/**
+ * Configuration of geocode instance
+ */
+type Config struct {
+	GoogleApiKey string        // google map api key
+	Language     string        // language e.g. en, zh-TW
+	Sources      []string      // sources to fall through in order, google if empty
+	BoundaryFile string        // GeoJSON of township boundaries for boundary source
+	Cache        *AddressCache // address cache, nil if addresses are not cached
+}
+
+type geoProvider struct {
+	source  string
+	handler googleMapGeocode
+}
+
+/**
+ * Class to fall through geocoding sources, it holds no state of request
+ */
+type fallbackGeo struct {
+	providers []geoProvider
+}
+
+/**
+ * @name fallThrough
+ * @brief Call the request with every source in order until one answers
+ * @param ctx The context of lookup, the rest sources are not tried once it is done
+ * @param request The request to one source
+ * @return []geocodeResult The results of the source which answers
+ * @return error The errors of every source, this will be nil if one source answers
+ */
+func (geo *fallbackGeo) fallThrough(ctx context.Context, request func(googleMapGeocode) ([]geocodeResult, error)) ([]geocodeResult, error) {
+
+	messages := []string{}
+	for _, provider := range geo.providers {
+		results, err := request(provider.handler)
+		if err == nil && len(results) > 0 {
+			return results, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err == nil {
+			err = errors.New("Get zero location result")
+		}
+		messages = append(messages, provider.source+": "+err.Error())
+	}
+
+	return nil, fmt.Errorf("all geocoding sources failed (%s)", strings.Join(messages, "; "))
+}
+
+func (geo *fallbackGeo) reverseGeocode(ctx context.Context, lat float64, lng float64) ([]geocodeResult, error) {
+	return geo.fallThrough(ctx, func(handler googleMapGeocode) ([]geocodeResult, error) {
+		return handler.reverseGeocode(ctx, lat, lng)
+	})
+}
+
+func (geo *fallbackGeo) geocode(ctx context.Context, query string) ([]geocodeResult, error) {
+	return geo.fallThrough(ctx, func(handler googleMapGeocode) ([]geocodeResult, error) {
+		return handler.geocode(ctx, query)
+	})
+}
+
+/**
+ * Create the handler of one geocoding source
+ */
+func newGeoHandler(source string, conf Config) (googleMapGeocode, error) {
+
+	switch source {
+	case GEOCODE_SOURCE_GOOGLE, "":
+		return newMapGeo(conf.GoogleApiKey, conf.Language, ""), nil
+	case GEOCODE_SOURCE_BOUNDARY:
+		return newBoundaryGeo(conf.BoundaryFile, conf.Language)
+	}
+
+	return nil, fmt.Errorf("unknown geocoding source: %s", source)
+}
+
+/**
+ * @name NewGeocodeByConfig
+ * @brief Create a geocode instance with the sources in configuration,
+ * e.g. Sources ["boundary", "google"] answers county and district offline
+ * and asks google only for addresses out of the boundaries and forward geocoding
+ * @param conf The configuration
+ * @return *Geocode The instance, it can be shared by goroutines
+ * @return error Error description, this will be nil if no error occurs
+ */
+func NewGeocodeByConfig(conf Config) (*Geocode, error) {
+
+	sources := conf.Sources
+	if len(sources) == 0 {
+		sources = []string{GEOCODE_SOURCE_GOOGLE}
+	}
+
+	providers := []geoProvider{}
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		handler, err := newGeoHandler(source, conf)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, geoProvider{source: source, handler: handler})
+	}
+
+	geo := Geocode{
+		geoHandler:   &fallbackGeo{providers: providers},
+		googleApiKey: conf.GoogleApiKey,
+		language:     conf.Language,
+		timeout:      GEOCODE_TIMEOUT,
+		cache:        conf.Cache,
+	}
+	if len(providers) == 1 {
+		geo.geoHandler = providers[0].handler
+	}
+
+	return &geo, nil
+}
@@ -2,6 +2,7 @@ package httpHandler
 
 import (
 	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
 )
@@ -20,3 +21,20 @@ func HttpGet(request string) ([]byte, error) {
 
 	return body, nil
 }
+
+/**
+ * Get the response body as a stream, the caller must close it
+ */
+func HttpGetStream(request string) (io.ReadCloser, error) {
+	resp, err := http.Get(request)
+	if err != nil {
+		return nil, errors.New("http.get failed")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New("http.get failed with status " + resp.Status)
+	}
+
+	return resp.Body, nil
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/kr/pretty"
@@ -17,15 +18,29 @@ import (
 )
 
 var config struct {
-	defaultPort  int
-	apiHost      string
-	apiPort      int
-	googleApiKey string
-	cwdApiKey    string
-	dbUrl        string
-	dbName       string
-	dbUsername   string
-	dbPassword   string
+	defaultPort         int
+	apiHost             string
+	apiPort             int
+	googleApiKey        string
+	cwdApiKey           string
+	owmApiKey           string
+	owmUrl              string
+	meteoSource         string
+	meteoSnapshot       string
+	meteoCacheTTL       time.Duration
+	meteoArchive        bool
+	nowcastDataId       string
+	suitability         meteorology.SuitabilityTable
+	geocodeCacheSize    int
+	geocodeCacheTTL     time.Duration
+	geocodeCacheCell    float64
+	geocodeCachePersist bool
+	geocodeSource       string
+	geocodeBoundary     string
+	dbUrl               string
+	dbName              string
+	dbUsername          string
+	dbPassword          string
 }
 
 func configure() error {
@@ -42,6 +57,31 @@ func configure() error {
 		config.apiPort = viper.GetInt("development.apiPort")
 		config.googleApiKey = viper.GetString("development.googleApiKey")
 		config.cwdApiKey = viper.GetString("development.cwdApiKey")
+		config.owmApiKey = viper.GetString("development.owmApiKey")
+		config.owmUrl = viper.GetString("development.owmUrl")
+		config.meteoSource = viper.GetString("development.meteoSource")
+		config.meteoSnapshot = viper.GetString("development.meteoSnapshot")
+		config.meteoCacheTTL = viper.GetDuration("development.meteoCacheTTL")
+		config.meteoArchive = viper.GetBool("development.meteoArchive")
+		config.nowcastDataId = viper.GetString("development.nowcastDataId")
+		config.suitability = meteorology.DefaultSuitabilityTable
+		if viper.IsSet("development.suitability") {
+			// the configured table replaces the default one as a whole
+			table := meteorology.SuitabilityTable{}
+			if err := viper.UnmarshalKey("development.suitability", &table); err != nil {
+				return err
+			}
+			if err := table.Validate(); err != nil {
+				return err
+			}
+			config.suitability = table
+		}
+		config.geocodeCacheSize = viper.GetInt("development.geocodeCacheSize")
+		config.geocodeCacheTTL = viper.GetDuration("development.geocodeCacheTTL")
+		config.geocodeCacheCell = viper.GetFloat64("development.geocodeCacheCell")
+		config.geocodeCachePersist = viper.GetBool("development.geocodeCachePersist")
+		config.geocodeSource = viper.GetString("development.geocodeSource")
+		config.geocodeBoundary = viper.GetString("development.geocodeBoundary")
 		config.dbUrl = viper.GetString("development.dbUrl")
 		config.dbName = viper.GetString("development.dbName")
 		config.dbUsername = viper.GetString("development.dbUsername")
@@ -51,6 +91,7 @@ func configure() error {
 	log.Printf("\nDevelopment Config found:\n default server port = %d\n"+
 		" api host = %s\n"+
 		" api port = %d\n"+
+		" meteorology source = %s\n"+
 		" db url = %s\n"+
 		" db name = %s\n"+
 		" db user = %s\n"+
@@ -58,6 +99,7 @@ func configure() error {
 		config.defaultPort,
 		config.apiHost,
 		config.apiPort,
+		config.meteoSource,
 		config.dbUrl,
 		config.dbName,
 		config.dbUsername,
@@ -66,6 +108,203 @@ func configure() error {
 	return nil
 }
 
+/**
+ * The clock shared by meteorology and algorithm, it is fixed by -time flag
+ */
+var appClock meteorology.Clock = meteorology.SystemClock
+
+/**
+ * Geocode instances shared by all requests, one for each language,
+ * reverse geocoding of every language is cached in one address cache
+ */
+var sharedGeocodes struct {
+	mutex    sync.Mutex
+	geocodes map[string]*geocoding.Geocode
+	cache    *geocoding.AddressCache
+}
+
+/**
+ * Get the geocoding configuration of the language,
+ * geocodeSource is a comma separated list e.g. "boundary,google"
+ */
+func geocodeConfigOf(language string, cache *geocoding.AddressCache) geocoding.Config {
+
+	conf := geocoding.Config{
+		GoogleApiKey: config.googleApiKey,
+		Language:     language,
+		BoundaryFile: config.geocodeBoundary,
+		Cache:        cache,
+	}
+	if config.geocodeSource != "" {
+		conf.Sources = strings.Split(config.geocodeSource, ",")
+	}
+
+	return conf
+}
+
+/**
+ * Check the geocoding sources in configuration at start,
+ * so a boundary file which can not be loaded is not replaced by google silently
+ */
+func checkGeocodeSources() error {
+
+	_, err := geocoding.NewGeocodeByConfig(geocodeConfigOf("en", nil))
+
+	return err
+}
+
+/**
+ * Get the shared geocode instance of the language e.g. en, zh-TW
+ */
+func geocodeOf(language string) *geocoding.Geocode {
+
+	sharedGeocodes.mutex.Lock()
+	defer sharedGeocodes.mutex.Unlock()
+
+	if sharedGeocodes.geocodes == nil {
+		sharedGeocodes.geocodes = map[string]*geocoding.Geocode{}
+		var backend geocoding.CacheBackend
+		if config.geocodeCachePersist {
+			backend = &geocodeCacheBackend{storage: NewStorage(config.dbUrl)}
+		}
+		sharedGeocodes.cache = geocoding.NewAddressCache(config.geocodeCacheSize, config.geocodeCacheTTL, config.geocodeCacheCell, backend)
+	}
+	geocode, ok := sharedGeocodes.geocodes[language]
+	if !ok {
+		var err error
+		geocode, err = geocoding.NewGeocodeByConfig(geocodeConfigOf(language, sharedGeocodes.cache))
+		if err != nil {
+			// the sources are checked at start, so this is a broken configuration
+			log.Fatalln("Failed to load geocoding sources :", err)
+		}
+		sharedGeocodes.geocodes[language] = geocode
+	}
+
+	return geocode
+}
+
+/**
+ * Get the counters of the shared address cache
+ */
+func geocodeCacheStats() geocoding.CacheStats {
+
+	// the cache is created with the first geocode instance
+	geocodeOf("en")
+
+	return sharedGeocodes.cache.Stats()
+}
+
+/**
+ * The archiver shared by all meteorology instances, so only one db session is used
+ */
+var sharedArchiver struct {
+	once     sync.Once
+	archiver *weatherArchiver
+}
+
+/**
+ * Create meteorology instance with the sources in configuration,
+ * meteoSource is a comma separated list e.g. "cwb,owm,file"
+ */
+func newMeteorology(logFile io.Writer) (*meteorology.Meteorology, error) {
+
+	conf := meteorology.Config{
+		Sources:       strings.Split(config.meteoSource, ","),
+		ApiKey:        config.cwdApiKey,
+		OwmApiKey:     config.owmApiKey,
+		OwmUrl:        config.owmUrl,
+		Language:      "en",
+		Snapshot:      config.meteoSnapshot,
+		CacheTTL:      config.meteoCacheTTL,
+		NowcastDataId: config.nowcastDataId,
+		Clock:         appClock,
+	}
+
+	if config.meteoArchive {
+		sharedArchiver.once.Do(func() {
+			sharedArchiver.archiver = &weatherArchiver{storage: NewStorage(config.dbUrl)}
+		})
+		conf.Archiver = sharedArchiver.archiver
+	}
+
+	return meteorology.NewMeteorologyByConfig(conf, logFile)
+}
+
+/**
+ * Meteorology instance shared by all requests, so health counters of sources are kept
+ */
+var sharedMeteorology struct {
+	mutex sync.Mutex
+	meteo *meteorology.Meteorology
+}
+
+/**
+ * Get the shared meteorology instance, it is created at the first call
+ */
+func meteorologyOf() (*meteorology.Meteorology, error) {
+
+	sharedMeteorology.mutex.Lock()
+	defer sharedMeteorology.mutex.Unlock()
+
+	if sharedMeteorology.meteo == nil {
+		meteo, err := newMeteorology(nil)
+		if err != nil {
+			return nil, err
+		}
+		sharedMeteorology.meteo = meteo
+	}
+
+	return sharedMeteorology.meteo, nil
+}
+
+/**
+ * Get the city at latitude and longtitude
+ */
+func cityOfLatlng(lat float64, lng float64) (string, error) {
+
+	geocode := geocodeOf("en")
+
+	return geocode.GetCityByLatlng(lat, lng)
+}
+
+/**
+ * Get the address at latitude and longtitude in the language e.g. en, zh-TW
+ */
+func addressOfLatlng(lat float64, lng float64, language string) (*geocoding.Address, error) {
+
+	geocode := geocodeOf(language)
+
+	return geocode.GetAddressByLatlng(lat, lng)
+}
+
+/**
+ * Get the best candidate location of address or landmark e.g. 台北101, Songshan Station
+ */
+func latlngOfAddress(query string, language string) (*geocoding.Candidate, error) {
+
+	geocode := geocodeOf(language)
+
+	candidates, err := geocode.GetLatlngByAddress(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &candidates[0], nil
+}
+
+/**
+ * Get current weather of the city at latitude and longtitude
+ */
+func weatherOfLatlng(meteo *meteorology.Meteorology, lat float64, lng float64) (*meteorology.Weather, error) {
+
+	city, err := cityOfLatlng(lat, lng)
+	if err != nil {
+		return nil, err
+	}
+
+	return meteo.GetWeather(city)
+}
+
 func meteoUtil(lat float64, lng float64, logFile string) error {
 
 	var file io.Writer = nil
@@ -82,7 +321,7 @@ func meteoUtil(lat float64, lng float64, logFile string) error {
 		}
 	}
 
-	geocode := geocoding.NewGeocode(config.googleApiKey, "en")
+	geocode := geocodeOf("en")
 
 	city, err := geocode.GetCityByLatlng(lat, lng)
 
@@ -93,7 +332,11 @@ func meteoUtil(lat float64, lng float64, logFile string) error {
 
 	pretty.Println(city)
 
-	meteo := meteorology.NewMeteorology(config.cwdApiKey, "en", file)
+	meteo, err := newMeteorology(file)
+	if err != nil {
+		log.Println("error: ", err)
+		return err
+	}
 	data, err := meteo.GetWeather(city)
 	if err != nil {
 		log.Println("error: ", err)
@@ -101,6 +344,58 @@ func meteoUtil(lat float64, lng float64, logFile string) error {
 	}
 
 	pretty.Println(data)
+	fmt.Println(data.Summary("en"))
+	pretty.Println(config.suitability.Score(data))
+
+	if sun, err := meteo.GetSunTimes(lat, lng); err == nil {
+		pretty.Println(sun)
+	} else {
+		log.Println("error: ", err)
+	}
+
+	observation, err := meteo.GetObservation(lat, lng)
+	if err != nil {
+		log.Println("error: ", err)
+	} else {
+		pretty.Println(observation)
+	}
+
+	nowcast, err := meteo.GetNowcast(lat, lng)
+	if err != nil {
+		log.Println("error: ", err)
+	} else {
+		for _, step := range nowcast.Steps {
+			fmt.Println(step.StartTime.Format("15:04"), "-", step.EndTime.Format("15:04"), step.Rain, "mm")
+		}
+	}
+
+	warnings, err := meteo.GetWarnings(city)
+	if err != nil {
+		log.Println("error: ", err)
+	} else {
+		pretty.Println(warnings)
+	}
+
+	// township names are matched in zh-TW dataset
+	address, err := addressOfLatlng(lat, lng, "zh-TW")
+	if err != nil {
+		log.Println("error: ", err)
+		return nil
+	}
+	pretty.Println(address)
+	county, district := address.County, address.District
+
+	now := meteo.Now()
+	forecasts, err := meteo.GetTownshipForecast(county, district, now, now.Add(12*time.Hour))
+	if err != nil {
+		log.Println("error: ", err)
+		return nil
+	}
+
+	pretty.Println(county, district, forecasts)
+	for _, forecast := range forecasts {
+		fmt.Println(forecast.StartTime.Format("01/02 15:04"), forecast.Weather.Summary("zh-TW"))
+	}
 
 	return nil
 }
@@ -140,6 +435,8 @@ func main() {
 	lngPtr := flag.Float64("lng", 121.56086, "longtitude of user position")
 	logFilePtr := flag.String("log", "", "log path <path|fg>")
 	port := flag.Int("port", 0, "port number")
+	addressPtr := flag.String("address", "", "address or landmark of user position e.g. 台北101, it replaces -lat and -lng")
+	timePtr := flag.String("time", "", "time to run as in RFC3339 e.g. 2016-09-09T18:00:00+08:00, empty for now")
 
 	flag.Parse()
 
@@ -150,6 +447,30 @@ func main() {
 		os.Exit(-1)
 	}
 
+	if err := checkGeocodeSources(); err != nil {
+		log.Println("geocoding source in config can not be loaded:", err)
+		os.Exit(-1)
+	}
+
+	if *timePtr != "" {
+		t, err := time.Parse(time.RFC3339, *timePtr)
+		if err != nil {
+			log.Println(err)
+			os.Exit(-1)
+		}
+		appClock = meteorology.NewFixedClock(t)
+	}
+
+	if *addressPtr != "" {
+		candidate, err := latlngOfAddress(*addressPtr, "en")
+		if err != nil {
+			log.Println(err)
+			os.Exit(-1)
+		}
+		log.Println("use", candidate.Address.FormattedAddress, "at", candidate.Lat, candidate.Lng)
+		*latPtr, *lngPtr = candidate.Lat, candidate.Lng
+	}
+
 	if (strings.Compare(*mode, "web") == 0 || strings.Compare(*mode, "api") == 0) && *port != 0 {
 		config.defaultPort = *port
 	}
@@ -174,7 +495,20 @@ func main() {
 			pretty.Println(err)
 			os.Exit(0)
 		}
-		element := ChoiceElement{Lat: *latPtr, Lng: *lngPtr, Time: time.Now()}
+		element := ChoiceElement{Lat: *latPtr, Lng: *lngPtr, Time: appClock.Now()}
+		if address, err := addressOfLatlng(*latPtr, *lngPtr, "en"); err == nil {
+			element.County = address.County
+			element.District = address.District
+			if meteo, err := meteorologyOf(); err == nil {
+				if weather, err := meteo.GetWeather(address.County); err == nil {
+					element.Weather = *weather
+				} else {
+					log.Println("save choice without weather: ", err)
+				}
+			}
+		} else {
+			log.Println("save choice without address: ", err)
+		}
 		err = storage.insertChoice(db, element)
 		if err != nil {
 			pretty.Println(err)
@@ -192,6 +526,17 @@ func main() {
 		pretty.Println("discoverInfo: ", discoverInfo)
 		choices := storage.findChoiceListByLocation(db, *latPtr, *lngPtr, 1000)
 		pretty.Println("choices: ", choices)
+		// join choices saved without weather with the archived weather at that time
+		if city, err := cityOfLatlng(*latPtr, *lngPtr); err == nil {
+			for _, choice := range choices {
+				if choice.Weather.Wx != 0 {
+					continue
+				}
+				if weather, err := storage.GetWeatherAt(db, city, choice.Lat, choice.Lng, choice.Time); err == nil {
+					pretty.Println(choice.Restaurant.Name, choice.Time, weather.Summary("en"))
+				}
+			}
+		}
 	case "web":
 		runWebServer()
 	case "api":
@@ -0,0 +1,99 @@
+/****************************************************************************
+ * This file is apparent temperature and UV index of weather.               *
+ * Apparent temperature follows Australian Bureau of Meteorology (Steadman) *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"math"
+)
+
+/**
+ * UV index levels of Central Weather Bureau, the same as WHO
+ */
+const (
+	UVI_LOW       = 0
+	UVI_MODERATE  = 3
+	UVI_HIGH      = 6
+	UVI_VERY_HIGH = 8
+	UVI_EXTREME   = 11
+)
+
+var uvLevels = []struct {
+	minimum int
+	en      string
+	zh      string
+}{
+	{UVI_EXTREME, "extreme", "危險級"},
+	{UVI_VERY_HIGH, "very high", "過量級"},
+	{UVI_HIGH, "high", "高量級"},
+	{UVI_MODERATE, "moderate", "中量級"},
+	{UVI_LOW, "low", "低量級"},
+}
+
+/**
+ * @name ApparentTemperature
+ * @brief Calculate how hot it feels, AT = Ta + 0.33e - 0.70ws - 4.00
+ * e is water vapour pressure in hPa, e = rh / 100 * 6.105 * exp(17.27 * Ta / (237.7 + Ta))
+ * @param temp The temperature in celsius
+ * @param humidity The relative humidity in percent
+ * @param wind The wind speed in m/s
+ * @return float64 The apparent temperature in celsius
+ */
+func ApparentTemperature(temp float64, humidity float64, wind float64) float64 {
+
+	e := humidity / 100 * 6.105 * math.Exp(17.27*temp/(237.7+temp))
+
+	return temp + 0.33*e - 0.70*wind - 4.00
+}
+
+/**
+ * @name roundCelsius
+ * @brief Round the temperature to the nearest degree, halves are rounded up
+ * e.g. -1.6 is -2 and -1.5 is -1, int() would truncate both toward zero
+ * @param temp The temperature in celsius
+ * @return int The rounded temperature
+ */
+func roundCelsius(temp float64) int {
+	return int(math.Floor(temp + 0.5))
+}
+
+/**
+ * @name fillApparentTemp
+ * @brief Calculate apparent temperature if the source doesn't supply it
+ * Temp is used if it is known, otherwise the middle of temperature range.
+ */
+func (weather *Weather) fillApparentTemp() {
+
+	if weather.ApparentTempKnown || weather.Humidity <= 0 {
+		return
+	}
+
+	temp := float64(weather.Temp)
+	if !weather.TempKnown {
+		temp = float64(weather.MinTemp+weather.MaxTemp) / 2
+	}
+
+	weather.ApparentTemp = roundCelsius(ApparentTemperature(temp, float64(weather.Humidity), weather.WindSpeed))
+	weather.ApparentTempKnown = true
+}
+
+/**
+ * @name UVLevel
+ * @brief Get the level of UV index
+ * @param language The language e.g. en, zh-TW
+ * @return string The level e.g. high, 高量級
+ */
+func (weather *Weather) UVLevel(language string) string {
+
+	for _, level := range uvLevels {
+		if weather.UVIndex >= level.minimum {
+			if isChinese(language) {
+				return level.zh
+			}
+			return level.en
+		}
+	}
+
+	return ""
+}
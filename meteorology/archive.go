@@ -0,0 +1,142 @@
+/****************************************************************************
+ * This file is the archive of datasets downloaded from Central Weather     *
+ * Bureau, the archive is stored by the caller e.g. mongodb.                *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"time"
+)
+
+/**
+ * One downloaded dataset, it is keyed by DataId and IssueTime
+ * IssueTime is the observation time for station observations.
+ */
+type ArchiveRecord struct {
+	DataId    string    `json:"dataId" bson:"dataId"`
+	IssueTime time.Time `json:"issueTime" bson:"issueTime"`
+	FetchedAt time.Time `json:"fetchedAt" bson:"fetchedAt"`
+	Raw       []byte    `json:"raw" bson:"raw"` // xml as responded by CWB
+}
+
+/**
+ * Interface to store downloaded datasets
+ */
+type Archiver interface {
+	Archive(ArchiveRecord) error
+}
+
+/**
+ * @name archive
+ * @brief Archive the downloaded dataset, failure of archive does not fail the request
+ * @param dataId The dataset id e.g. F-C0032-001
+ * @param issueTime The issue time string from xml
+ * @param raw The xml as responded by CWB
+ */
+func (meteo *cwdMeteo) archive(dataId string, issueTime string, raw []byte) {
+
+	if meteo.archiver == nil {
+		return
+	}
+
+	t, err := parseCwbTime(issueTime)
+	if err != nil {
+		if meteo.logLevel == 1 {
+			meteo.logger.Println("archive", dataId, err)
+		}
+		return
+	}
+
+	err = meteo.archiver.Archive(ArchiveRecord{DataId: dataId, IssueTime: t, FetchedAt: time.Now(), Raw: raw})
+	if err != nil && meteo.logLevel == 1 {
+		meteo.logger.Println("archive", dataId, err)
+	}
+}
+
+/**
+ * @name WeatherOfArchive
+ * @brief Get weather of the location at the time from an archived forecast dataset
+ * @param record The archived F-C0032 dataset
+ * @param location The location e.g. Taipei City, 臺北市
+ * @param t The time in the forecast periods of dataset
+ * @return *Weather The weather of the period containing the time, a period near the time is not used
+ * because it is not the weather which applied at that time
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func WeatherOfArchive(record ArchiveRecord, location string, t time.Time) (*Weather, error) {
+
+	if record.DataId != CENTRAL_WEATHER_BUREAU_DATA_ID_ZH && record.DataId != CENTRAL_WEATHER_BUREAU_DATA_ID_EN {
+		return nil, errors.New("not an archive of forecast: " + record.DataId)
+	}
+
+	dataOfLocation, _, err := decodeLocationOf(bytes.NewReader(record.Raw), location)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := newCwdMeteo("", "", nil)
+	parser.strictPeriod = true
+	wx, err := parser.getParameter(*dataOfLocation, t, "Wx")
+	if err != nil {
+		return nil, err
+	}
+
+	weather, err := parser.weatherOfPeriod(*dataOfLocation, wx.StartTime)
+	if err != nil {
+		return nil, err
+	}
+	weather.Source = METEO_SOURCE_CWB
+
+	return weather, nil
+}
+
+/**
+ * @name ObservationOfArchive
+ * @brief Get observation of the nearest station from an archived observation dataset
+ * @param record The archived O-A0001 dataset
+ * @param lat The latitude of location
+ * @param lng The longtitude of location
+ * @param t The time to calculate age of observation
+ * @return *Observation The observation of the nearest station which measures temperature
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func ObservationOfArchive(record ArchiveRecord, lat float64, lng float64, t time.Time) (*Observation, error) {
+
+	if record.DataId != CENTRAL_WEATHER_BUREAU_OBSERVATION_ID {
+		return nil, errors.New("not an archive of observation: " + record.DataId)
+	}
+
+	data := observationWeathers{}
+	if err := xml.Unmarshal(record.Raw, &data); err != nil {
+		return nil, err
+	}
+
+	return observationOfLatlng(&data, nil, lat, lng, t)
+}
+
+/**
+ * @name Apply
+ * @brief Replace temperature, humidity and wind of forecast with the measured ones,
+ * elements which the station fails to measure are kept
+ * @param weather The weather to update
+ */
+func (obs *Observation) Apply(weather *Weather) {
+
+	if obs.TempKnown {
+		weather.Temp = roundCelsius(obs.Temp)
+		weather.TempKnown = true
+	}
+	if obs.HumidityKnown {
+		weather.Humidity = obs.Humidity
+	}
+	if obs.WindSpeedKnown {
+		weather.WindSpeed = obs.WindSpeed
+	}
+	if obs.ApparentTempKnown {
+		weather.ApparentTemp = roundCelsius(obs.ApparentTemp)
+		weather.ApparentTempKnown = true
+	}
+}
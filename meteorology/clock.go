@@ -0,0 +1,71 @@
+/****************************************************************************
+ * This file is the clock and time zone of meteorology.                     *
+ * The clock can be replaced to test time dependent behaviour.              *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"time"
+)
+
+/**
+ * Time zone of Central Weather Bureau, every time from xml is in +08:00
+ */
+var CWB_TIME_ZONE = time.FixedZone("UTC+8", 8*60*60)
+
+/**
+ * Interface of the source of "now"
+ */
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+/**
+ * @name Now
+ * @brief Get current time in the time zone of Central Weather Bureau,
+ * so "today" is the same day as in Taiwan wherever the server runs
+ * @return time.Time The current time
+ */
+func (clock systemClock) Now() time.Time {
+	return time.Now().In(CWB_TIME_ZONE)
+}
+
+/**
+ * The clock of wall time, it is used if no clock is configured
+ */
+var SystemClock Clock = systemClock{}
+
+type fixedClock struct {
+	t time.Time
+}
+
+func (clock fixedClock) Now() time.Time {
+	return clock.t
+}
+
+/**
+ * @name NewFixedClock
+ * @brief Create a clock which always answers the same time
+ * @param t The time to answer
+ * @return Clock The clock
+ */
+func NewFixedClock(t time.Time) Clock {
+	return fixedClock{t: t}
+}
+
+/**
+ * @name parseCwbTime
+ * @brief Parse RFC3339 time from xml into the time zone of Central Weather Bureau
+ * @param value The time string e.g. 2016-09-09T18:00:00+08:00
+ * @return time.Time The time
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func parseCwbTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(CWB_TIME_ZONE), nil
+}
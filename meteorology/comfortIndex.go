@@ -0,0 +1,117 @@
+/****************************************************************************
+ * This file is parser of comfort index (CI) from Central Weather Bureau.   *
+ * CWB grades the comfort index from 非常寒冷 to 易中暑.                    *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"strconv"
+	"strings"
+)
+
+/**
+ * The bounds used for the open ends of the comfort index scale
+ */
+const (
+	CI_VALUE_LOWEST  = 0
+	CI_VALUE_HIGHEST = 50
+)
+
+type comfortLevel struct {
+	ci      int
+	names   []string // zh-TW name first, then English names
+	minimum int
+	maximum int
+}
+
+/**
+ * The comfort index scale of CWB, ordered from cold to hot
+ */
+var comfortScale = []comfortLevel{
+	{ci: CI_VERY_COLD, names: []string{"非常寒冷", "VERY COLD"}, minimum: CI_VALUE_LOWEST, maximum: 10},
+	{ci: CI_COLD, names: []string{"寒冷", "COLD"}, minimum: 11, maximum: 15},
+	{ci: CI_CHILLY, names: []string{"稍有寒意", "SLIGHTLY COLD", "CHILLY", "COOL"}, minimum: 16, maximum: 19},
+	{ci: CI_COMFORTABLE, names: []string{"舒適", "COMFORTABLE"}, minimum: 20, maximum: 26},
+	{ci: CI_HOT, names: []string{"悶熱", "HOT", "MUGGY"}, minimum: 27, maximum: 30},
+	{ci: CI_VERY_HOT, names: []string{"易中暑", "VERY HOT", "HEAT STROKE", "SWELTERING"}, minimum: 31, maximum: CI_VALUE_HIGHEST},
+}
+
+/**
+ * @name comfortLevelOf
+ * @brief Find the level of one comfort description or number
+ * @param desc The description, e.g. 舒適, COMFORTABLE or 24
+ * @return int The index of level in comfortScale, -1 if not found
+ */
+func comfortLevelOf(desc string) int {
+
+	desc = strings.ToUpper(strings.TrimSpace(desc))
+
+	if value, err := strconv.Atoi(desc); err == nil {
+		for index, level := range comfortScale {
+			if value <= level.maximum {
+				return index
+			}
+		}
+		return len(comfortScale) - 1
+	}
+
+	for index, level := range comfortScale {
+		for _, name := range level.names {
+			if desc == name {
+				return index
+			}
+		}
+	}
+
+	return -1
+}
+
+/**
+ * @name transformCIToEnum
+ * @brief Parse comfort index description into CI_ bitmap and value range
+ * A range like 舒適至悶熱 or COMFORTABLE~HOT sets every level it covers.
+ * @param desc The description in English or Chinese, or the index number
+ * @return int The CI_ bitmap, 0 if nothing can be parsed
+ * @return int The minimum comfort index
+ * @return int The maximum comfort index
+ */
+func transformCIToEnum(desc string) (int, int, int) {
+
+	parts := strings.FieldsFunc(desc, func(r rune) bool {
+		return r == '~' || r == '至' || r == '到'
+	})
+
+	low, high := -1, -1
+	for _, part := range parts {
+		index := comfortLevelOf(part)
+		if index < 0 {
+			continue
+		}
+		if low < 0 || index < low {
+			low = index
+		}
+		if high < 0 || index > high {
+			high = index
+		}
+	}
+
+	if low < 0 {
+		return 0, 0, 0
+	}
+
+	res := 0
+	for _, level := range comfortScale[low : high+1] {
+		res |= level.ci
+	}
+
+	minimum, maximum := comfortScale[low].minimum, comfortScale[high].maximum
+
+	// a single number is an exact comfort index
+	if len(parts) == 1 {
+		if value, err := strconv.Atoi(strings.TrimSpace(parts[0])); err == nil {
+			minimum, maximum = value, value
+		}
+	}
+
+	return res, minimum, maximum
+}
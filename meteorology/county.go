@@ -0,0 +1,120 @@
+/****************************************************************************
+ * This file is the table of counties and cities in Taiwan.                 *
+ * Names follow the datasets of Central Weather Bureau.                     *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"errors"
+	"strings"
+)
+
+type county struct {
+	zh             string   // name in zh-TW dataset
+	en             string   // name in en dataset
+	cn             string   // name in Simplified Chinese
+	aliases        []string // other names e.g. short names and names before 2010
+	townshipDataId string   // township forecast of 2 days every 3 hours
+}
+
+var countyTable = []county{
+	{zh: "臺北市", en: "Taipei City", cn: "台北市", aliases: []string{"Taipei", "臺北"}, townshipDataId: "F-D0047-061"},
+	{zh: "新北市", en: "New Taipei City", cn: "新北市", aliases: []string{"New Taipei", "Taipei County", "臺北縣", "新北"}, townshipDataId: "F-D0047-069"},
+	{zh: "桃園市", en: "Taoyuan City", cn: "桃园市", aliases: []string{"Taoyuan", "Taoyuan County", "桃園縣", "桃园县", "桃園"}, townshipDataId: "F-D0047-005"},
+	{zh: "臺中市", en: "Taichung City", cn: "台中市", aliases: []string{"Taichung", "Taichung County", "臺中縣", "臺中"}, townshipDataId: "F-D0047-073"},
+	{zh: "臺南市", en: "Tainan City", cn: "台南市", aliases: []string{"Tainan", "Tainan County", "臺南縣", "臺南"}, townshipDataId: "F-D0047-077"},
+	{zh: "高雄市", en: "Kaohsiung City", cn: "高雄市", aliases: []string{"Kaohsiung", "Kaohsiung County", "高雄縣", "高雄县", "高雄"}, townshipDataId: "F-D0047-065"},
+	{zh: "基隆市", en: "Keelung City", cn: "基隆市", aliases: []string{"Keelung", "Jilong City", "基隆"}, townshipDataId: "F-D0047-049"},
+	{zh: "新竹縣", en: "Hsinchu County", cn: "新竹县", aliases: []string{"Xinzhu County"}, townshipDataId: "F-D0047-009"},
+	{zh: "新竹市", en: "Hsinchu City", cn: "新竹市", aliases: []string{"Hsinchu", "Xinzhu City"}, townshipDataId: "F-D0047-053"},
+	{zh: "苗栗縣", en: "Miaoli County", cn: "苗栗县", aliases: []string{"Miaoli", "苗栗"}, townshipDataId: "F-D0047-013"},
+	{zh: "彰化縣", en: "Changhua County", cn: "彰化县", aliases: []string{"Changhua", "彰化"}, townshipDataId: "F-D0047-017"},
+	{zh: "南投縣", en: "Nantou County", cn: "南投县", aliases: []string{"Nantou", "南投"}, townshipDataId: "F-D0047-021"},
+	{zh: "雲林縣", en: "Yunlin County", cn: "云林县", aliases: []string{"Yunlin", "雲林", "云林"}, townshipDataId: "F-D0047-025"},
+	{zh: "嘉義縣", en: "Chiayi County", cn: "嘉义县", aliases: []string{"Jiayi County"}, townshipDataId: "F-D0047-029"},
+	{zh: "嘉義市", en: "Chiayi City", cn: "嘉义市", aliases: []string{"Chiayi", "Jiayi City"}, townshipDataId: "F-D0047-057"},
+	{zh: "屏東縣", en: "Pingtung County", cn: "屏东县", aliases: []string{"Pingtung", "屏東", "屏东"}, townshipDataId: "F-D0047-033"},
+	{zh: "宜蘭縣", en: "Yilan County", cn: "宜兰县", aliases: []string{"Yilan", "Ilan County", "宜蘭", "宜兰"}, townshipDataId: "F-D0047-001"},
+	{zh: "花蓮縣", en: "Hualien County", cn: "花莲县", aliases: []string{"Hualien", "花蓮", "花莲"}, townshipDataId: "F-D0047-041"},
+	{zh: "臺東縣", en: "Taitung County", cn: "台东县", aliases: []string{"Taitung", "臺東", "台东"}, townshipDataId: "F-D0047-037"},
+	{zh: "澎湖縣", en: "Penghu County", cn: "澎湖县", aliases: []string{"Penghu", "澎湖"}, townshipDataId: "F-D0047-045"},
+	{zh: "金門縣", en: "Kinmen County", cn: "金门县", aliases: []string{"Kinmen", "Jinmen County", "金門", "金门"}, townshipDataId: "F-D0047-085"},
+	{zh: "連江縣", en: "Lienchiang County", cn: "连江县", aliases: []string{"Lienchiang", "Matsu", "Lianjiang County", "連江", "连江", "馬祖", "马祖"}, townshipDataId: "F-D0047-081"},
+}
+
+/**
+ * Index from normalized names to counties, built from countyTable
+ */
+var countyIndex = func() map[string]*county {
+	index := make(map[string]*county)
+	for i := range countyTable {
+		c := &countyTable[i]
+		for _, name := range append([]string{c.zh, c.en, c.cn}, c.aliases...) {
+			index[normalizeCountyName(name)] = c
+		}
+	}
+	return index
+}()
+
+/**
+ * @name normalizeCountyName
+ * @brief Normalize the name for matching
+ * 台 is written as 臺 in CWB datasets, English names are matched case-insensitively
+ * and hyphens are treated as spaces.
+ * @param name The name e.g. 台北市, TAIPEI CITY
+ * @return string The normalized name e.g. 臺北市, taipei city
+ */
+func normalizeCountyName(name string) string {
+
+	name = strings.Replace(name, "台", "臺", -1)
+	name = strings.Replace(name, "-", " ", -1)
+
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+/**
+ * @name findCounty
+ * @brief Find the county by its name
+ * @param name The name in English, Traditional or Simplified Chinese e.g. 台北市, 臺北市, Taipei City
+ * @return *county The county
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func findCounty(name string) (*county, error) {
+
+	if c, ok := countyIndex[normalizeCountyName(name)]; ok {
+		return c, nil
+	}
+
+	return nil, errors.New("can not find county with related name")
+}
+
+/**
+ * @name CountyName
+ * @brief Get the name of county used in CWB dataset of the language
+ * @param name The name in English, Traditional or Simplified Chinese e.g. 台北市, Taipei
+ * @param language The language e.g. zh-TW, en
+ * @return string The name in CWB dataset e.g. 臺北市, Taipei City
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func CountyName(name string, language string) (string, error) {
+
+	c, err := findCounty(name)
+	if err != nil {
+		return "", err
+	}
+	if isChinese(language) {
+		return c.zh, nil
+	}
+
+	return c.en, nil
+}
+
+/**
+ * @name isChinese
+ * @brief Check if the language selects zh-TW datasets of CWB
+ * @param language The language e.g. zh-TW, zh, en
+ * @return bool True for Chinese
+ */
+func isChinese(language string) bool {
+	return strings.HasPrefix(strings.ToLower(language), "zh")
+}
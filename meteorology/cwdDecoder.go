@@ -0,0 +1,211 @@
+/****************************************************************************
+ * This file is streaming decoder of CWB datasets. The response is decoded *
+ * while it is downloaded, F-C0032 locations are decoded one by one.        *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/xu354cjo1008/eatingFinder/httpHandler"
+)
+
+/**
+ * @name download
+ * @brief Download the dataset and decode it from the response stream,
+ * the raw xml is kept only if it is archived
+ * @param dataId The dataset id e.g. O-A0001-001
+ * @param decode The decoder of the dataset
+ * @return []byte The raw xml, nil if datasets are not archived
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *cwdMeteo) download(dataId string, decode func(io.Reader) error) ([]byte, error) {
+
+	reqUrl := fmt.Sprintf(CENTRAL_WEATHER_BUREAU_URL, dataId, meteo.apiKey)
+	resp, err := httpHandler.HttpGetStream(reqUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	var r io.Reader = resp
+	var raw bytes.Buffer
+	if meteo.archiver != nil {
+		r = io.TeeReader(resp, &raw)
+	}
+
+	if err := decode(r); err != nil {
+		return nil, err
+	}
+
+	return raw.Bytes(), nil
+}
+
+/**
+ * @name decodeXml
+ * @brief Decode the whole dataset from the stream, the response is not read into memory first
+ * @param r The xml stream
+ * @param v The dataset structure
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func decodeXml(r io.Reader, v interface{}) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+/**
+ * @name decodeDataset
+ * @brief Walk through the dataset, every location is passed to the visitor
+ * @param r The xml stream
+ * @param v The dataset with dataid and datasetInfo filled while walking
+ * @param visit The visitor, decode the location by itself or skip it,
+ *  return true to stop walking
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func decodeDataset(r io.Reader, v *Weathers, visit func(*xml.Decoder, *xml.StartElement) (bool, error)) error {
+
+	decoder := xml.NewDecoder(r)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "dataid":
+			err = decoder.DecodeElement(&v.DataId, &start)
+		case "datasetInfo":
+			err = decoder.DecodeElement(&v.DataSet.DatasetInfo, &start)
+		case "location":
+			var stop bool
+			stop, err = visit(decoder, &start)
+			if err == nil && stop {
+				return nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+/**
+ * @name decodeWeathers
+ * @brief Decode the whole dataset and index its locations by county
+ * @param r The xml stream
+ * @return *Weathers The dataset
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func decodeWeathers(r io.Reader) (*Weathers, error) {
+
+	v := Weathers{}
+	err := decodeDataset(r, &v, func(decoder *xml.Decoder, start *xml.StartElement) (bool, error) {
+		data := location{}
+		if err := decoder.DecodeElement(&data, start); err != nil {
+			return false, err
+		}
+		v.DataSet.Locations = append(v.DataSet.Locations, data)
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	v.DataSet.index = make(map[*county]int)
+	for index, data := range v.DataSet.Locations {
+		if c, err := findCounty(data.LocationName); err == nil {
+			v.DataSet.index[c] = index
+		}
+	}
+
+	return &v, nil
+}
+
+/**
+ * @name decodeLocationOf
+ * @brief Decode only the location of the county, it stops right after the location
+ * and other locations are skipped without being decoded
+ * @param r The xml stream
+ * @param name The location e.g. Taipei City, 臺北市
+ * @return *location The location
+ * @return *datasetInfo The information of dataset
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func decodeLocationOf(r io.Reader, name string) (*location, *datasetInfo, error) {
+
+	c, err := findCounty(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v := Weathers{}
+	var found *location
+	err = decodeDataset(r, &v, func(decoder *xml.Decoder, start *xml.StartElement) (bool, error) {
+		// locationName is the first child of location
+		var locationName string
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return false, err
+			}
+			if child, ok := token.(xml.StartElement); ok {
+				if child.Name.Local != "locationName" {
+					return false, decoder.Skip()
+				}
+				if err := decoder.DecodeElement(&locationName, &child); err != nil {
+					return false, err
+				}
+				break
+			}
+		}
+
+		if lc, err := findCounty(locationName); err != nil || lc != c {
+			return false, decoder.Skip()
+		}
+
+		data := location{LocationName: locationName}
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return false, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				if t.Name.Local != "weatherElement" {
+					if err := decoder.Skip(); err != nil {
+						return false, err
+					}
+					continue
+				}
+				element := weatherElement{}
+				if err := decoder.DecodeElement(&element, &t); err != nil {
+					return false, err
+				}
+				data.WeatherElements = append(data.WeatherElements, element)
+			case xml.EndElement:
+				found = &data
+				return true, nil
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if found == nil {
+		return nil, nil, errors.New("can not find data for the location")
+	}
+
+	return found, &v.DataSet.DatasetInfo, nil
+}
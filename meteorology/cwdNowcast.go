@@ -0,0 +1,286 @@
+/****************************************************************************
+ * This file is xml parser for gridded quantitative precipitation nowcast   *
+ * from Central Weather Bureau. The example xml file is F-B0046-001.xml     *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * The default dataset of nowcast, it can be replaced by Config.NowcastDataId
+ */
+const CENTRAL_WEATHER_BUREAU_NOWCAST_ID string = "F-B0046-001"
+
+/**
+ * The nowcast is issued every 10 minutes for the next hour
+ */
+const (
+	CWB_NOWCAST_TTL     = 10 * time.Minute
+	CWB_NOWCAST_HORIZON = time.Hour
+)
+
+/**
+ * Rainfall in mm of one 10 minutes step which is regarded as raining
+ */
+const NOWCAST_RAIN_THRESHOLD = 0.1
+
+var errNoNowcastSource = errors.New("no meteorology source supports nowcast")
+
+/**
+ * The xml structure of gridded nowcast from Central Weather Bureau
+ */
+type nowcastWeathers struct {
+	XMLName xml.Name       `xml:"cwbopendata"`
+	DataId  string         `xml:"dataid"`
+	Sent    string         `xml:"sent"`
+	DataSet nowcastDataset `xml:"dataset"`
+}
+
+type nowcastDataset struct {
+	XMLName     xml.Name         `xml:"dataset"`
+	IssueTime   string           `xml:"datasetInfo>issueTime"`
+	Grid        nowcastGridInfo  `xml:"datasetInfo>parameterSet"`
+	Contents    []nowcastContent `xml:"contents>content"`
+	stepsOfGrid [][]float64      // values of every step, parsed once when the dataset is fetched
+}
+
+/**
+ * Grid of CWB gridded datasets, the first value is at the start point in the south west
+ */
+type nowcastGridInfo struct {
+	Lng        float64 `xml:"StartPointLongitude"`
+	Lat        float64 `xml:"StartPointLatitude"`
+	Resolution float64 `xml:"GridResolution"` // degrees between cells
+	DimensionX int     `xml:"GridDimensionX"`
+	DimensionY int     `xml:"GridDimensionY"`
+}
+
+type nowcastContent struct {
+	XMLName   xml.Name `xml:"content"`
+	StartTime string   `xml:"startTime"`
+	EndTime   string   `xml:"endTime"`
+	Values    string   `xml:"values"` // comma separated e.g. 1.50E+00, row by row from south to north, west to east in a row
+}
+
+/**
+ * Expected rainfall of one 10 minutes step, the period is [StartTime, EndTime)
+ */
+type NowcastStep struct {
+	StartTime time.Time `json:"startTime" bson:"startTime"`
+	EndTime   time.Time `json:"endTime" bson:"endTime"`
+	Rain      float64   `json:"rain" bson:"rain"` // mm in the step
+}
+
+/**
+ * Rain nowcast of the grid cell nearest to the location
+ */
+type Nowcast struct {
+	IssueTime time.Time     `json:"issueTime" bson:"issueTime"`
+	Lat       float64       `json:"lat" bson:"lat"` // center of the grid cell
+	Lng       float64       `json:"lng" bson:"lng"`
+	Steps     []NowcastStep `json:"steps" bson:"steps"` // the next 60 minutes in 10 minutes steps
+}
+
+/**
+ * @name TotalRain
+ * @brief Get the expected rainfall of every step
+ * @return float64 The rainfall in mm
+ */
+func (nowcast *Nowcast) TotalRain() float64 {
+	total := 0.0
+	for _, step := range nowcast.Steps {
+		total += step.Rain
+	}
+	return total
+}
+
+/**
+ * @name FirstRain
+ * @brief Find the first step in which it rains
+ * @return *NowcastStep The step, nil if it doesn't rain in the next hour
+ */
+func (nowcast *Nowcast) FirstRain() *NowcastStep {
+	for index := range nowcast.Steps {
+		if nowcast.Steps[index].Rain >= NOWCAST_RAIN_THRESHOLD {
+			return &nowcast.Steps[index]
+		}
+	}
+	return nil
+}
+
+/**
+ * @name RainsWithin
+ * @brief Check if it starts raining within the duration from the time
+ * @param t The time e.g. now
+ * @param d The duration e.g. 30 minutes to walk over
+ * @return bool True if rain is expected in a step which starts before t+d
+ */
+func (nowcast *Nowcast) RainsWithin(t time.Time, d time.Duration) bool {
+	step := nowcast.FirstRain()
+	return step != nil && step.StartTime.Before(t.Add(d))
+}
+
+/**
+ * @name parseGrid
+ * @brief Parse the values of every step
+ * @param data The dataset of nowcast
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (data *nowcastDataset) parseGrid() error {
+
+	grid := data.Grid
+	if grid.DimensionX <= 0 || grid.DimensionY <= 0 || grid.Resolution <= 0 {
+		return errors.New("invalid nowcast grid")
+	}
+
+	data.stepsOfGrid = make([][]float64, len(data.Contents))
+	for index, content := range data.Contents {
+		fields := strings.FieldsFunc(content.Values, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+		})
+		if len(fields) != grid.DimensionX*grid.DimensionY {
+			return fmt.Errorf("nowcast step %d has %d values, expected %d", index, len(fields), grid.DimensionX*grid.DimensionY)
+		}
+		values := make([]float64, len(fields))
+		for i, field := range fields {
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return err
+			}
+			values[i] = value
+		}
+		data.stepsOfGrid[index] = values
+	}
+
+	return nil
+}
+
+/**
+ * @name nowcastOfLatlng
+ * @brief Sample the grid at the location for the next 60 minutes from the time
+ * @param data The dataset of nowcast, the grid must be parsed
+ * @param lat The latitude of location
+ * @param lng The longtitude of location
+ * @param t The reference time, steps which have ended are dropped
+ * @return *Nowcast The nowcast of the nearest grid cell
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func nowcastOfLatlng(data *nowcastDataset, lat float64, lng float64, t time.Time) (*Nowcast, error) {
+
+	grid := data.Grid
+	x := int(math.Floor((lng-grid.Lng)/grid.Resolution + 0.5))
+	y := int(math.Floor((lat-grid.Lat)/grid.Resolution + 0.5))
+	if x < 0 || x >= grid.DimensionX || y < 0 || y >= grid.DimensionY {
+		return nil, errors.New("location is out of nowcast grid")
+	}
+
+	issueTime, err := parseCwbTime(data.IssueTime)
+	if err != nil {
+		return nil, err
+	}
+
+	nowcast := Nowcast{
+		IssueTime: issueTime,
+		Lat:       grid.Lat + float64(y)*grid.Resolution,
+		Lng:       grid.Lng + float64(x)*grid.Resolution,
+		Steps:     []NowcastStep{},
+	}
+
+	horizon := t.Add(CWB_NOWCAST_HORIZON)
+	for index, content := range data.Contents {
+		startTime, err := parseCwbTime(content.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		endTime, err := parseCwbTime(content.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		if !endTime.After(t) || !startTime.Before(horizon) {
+			continue
+		}
+		rain := data.stepsOfGrid[index][y*grid.DimensionX+x]
+		// rainfall is never negative, CWB fills -99 or -999 where there is no data and 0 is a dry cell
+		if rain < 0 {
+			return nil, errors.New("no nowcast at location")
+		}
+		nowcast.Steps = append(nowcast.Steps, NowcastStep{
+			StartTime: startTime,
+			EndTime:   endTime,
+			Rain:      rain,
+		})
+	}
+	if len(nowcast.Steps) == 0 {
+		return nil, errors.New("nowcast is out of date")
+	}
+
+	return &nowcast, nil
+}
+
+/**
+ * Parsing gridded nowcast from Central Weather Bureau
+ */
+func (meteo *cwdMeteo) fetchNowcast(dataId string) (*nowcastWeathers, error) {
+	v := nowcastWeathers{}
+	raw, err := meteo.download(dataId, func(r io.Reader) error {
+		return decodeXml(r, &v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := v.DataSet.parseGrid(); err != nil {
+		return nil, err
+	}
+
+	meteo.archive(dataId, v.Sent, raw)
+
+	return &v, nil
+}
+
+/**
+ * Get gridded nowcast from the shared dataset cache
+ */
+func (meteo *cwdMeteo) requestNowcast(dataId string) (*nowcastWeathers, error) {
+
+	ttl := meteo.cacheTTL
+	if ttl == 0 || ttl > CWB_NOWCAST_TTL {
+		ttl = CWB_NOWCAST_TTL
+	}
+
+	data, err := sharedDatasetCache.get(dataId, ttl, func() (interface{}, *datasetInfo, error) {
+		v, err := meteo.fetchNowcast(dataId)
+		if err != nil {
+			return nil, nil, err
+		}
+		return v, nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data.(*nowcastWeathers), nil
+}
+
+func (meteo *cwdMeteo) getNowcast(lat float64, lng float64, t time.Time) (*Nowcast, error) {
+
+	dataId := meteo.nowcastDataId
+	if dataId == "" {
+		dataId = CENTRAL_WEATHER_BUREAU_NOWCAST_ID
+	}
+
+	data, err := meteo.requestNowcast(dataId)
+	if err != nil {
+		return nil, err
+	}
+
+	return nowcastOfLatlng(&data.DataSet, lat, lng, t)
+}
@@ -0,0 +1,283 @@
+/****************************************************************************
+ * This file is xml parser for station observations from Central Weather    *
+ * Bureau. The example xml files are in O-A0001-001.xml and O-A0002-001.xml *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/StefanSchroeder/Golang-Ellipsoid/ellipsoid"
+)
+
+const (
+	CENTRAL_WEATHER_BUREAU_OBSERVATION_ID string = "O-A0001-001"
+	CENTRAL_WEATHER_BUREAU_RAIN_ID        string = "O-A0002-001"
+)
+
+/**
+ * Stations report every 10 minutes to 1 hour
+ */
+const CWB_OBSERVATION_TTL = 10 * time.Minute
+
+/**
+ * Value of element when the station fails to measure
+ */
+const CWB_MISSING_VALUE = -98
+
+var errNoObservationSource = errors.New("no meteorology source supports observations")
+
+/**
+ * The xml structure of station observations from Central Weather Bureau
+ */
+type observationWeathers struct {
+	XMLName  xml.Name             `xml:"cwbopendata"`
+	DataId   string               `xml:"dataid"`
+	Sent     string               `xml:"sent"`
+	Stations []observationStation `xml:"location"`
+}
+
+type observationStation struct {
+	XMLName         xml.Name             `xml:"location"`
+	Lat             float64              `xml:"lat"`
+	Lon             float64              `xml:"lon"`
+	LocationName    string               `xml:"locationName"`
+	StationId       string               `xml:"stationId"`
+	ObsTime         string               `xml:"time>obsTime"`
+	WeatherElements []observationElement `xml:"weatherElement"`
+	Parameters      []observationParam   `xml:"parameter"`
+}
+
+type observationElement struct {
+	XMLName     xml.Name `xml:"weatherElement"`
+	ElementName string   `xml:"elementName"`
+	Value       string   `xml:"elementValue>value"`
+}
+
+type observationParam struct {
+	XMLName        xml.Name `xml:"parameter"`
+	ParameterName  string   `xml:"parameterName"`
+	ParameterValue string   `xml:"parameterValue"`
+}
+
+/**
+ * Current observation of the nearest station
+ */
+type Observation struct {
+	StationId     string        `json:"stationId" bson:"stationId"`
+	StationName   string        `json:"stationName" bson:"stationName"`
+	County        string        `json:"county" bson:"county"`
+	Distance      float64       `json:"distance" bson:"distance"` // meters from the location
+	ObsTime       time.Time     `json:"obsTime" bson:"obsTime"`
+	Age           time.Duration `json:"age" bson:"age"`                     // time since the observation
+	Temp          float64       `json:"temp" bson:"temp"`                   // celsius, valid if TempKnown
+	ApparentTemp  float64       `json:"apparentTemp" bson:"apparentTemp"`   // celsius, valid if ApparentTempKnown
+	Humidity      int           `json:"humidity" bson:"humidity"`           // percent, valid if HumidityKnown
+	WindSpeed     float64       `json:"windSpeed" bson:"windSpeed"`         // m/s, valid if WindSpeedKnown
+	WindDirection int           `json:"windDirection" bson:"windDirection"` // degrees
+	Rain          float64       `json:"rain" bson:"rain"`                   // mm in the last hour
+	RainStation   string        `json:"rainStation,omitempty" bson:"rainStation,omitempty"`
+	RainDistance  float64       `json:"rainDistance,omitempty" bson:"rainDistance,omitempty"`
+
+	// the station may fail to measure some elements, 0 is a valid measurement
+	TempKnown         bool `json:"tempKnown,omitempty" bson:"tempKnown,omitempty"`
+	HumidityKnown     bool `json:"humidityKnown,omitempty" bson:"humidityKnown,omitempty"`
+	WindSpeedKnown    bool `json:"windSpeedKnown,omitempty" bson:"windSpeedKnown,omitempty"`
+	ApparentTempKnown bool `json:"apparentTempKnown,omitempty" bson:"apparentTempKnown,omitempty"` // all of temperature, humidity and wind speed are known
+}
+
+/**
+ * @name IsRaining
+ * @brief Check if it rained in the last hour
+ * @return bool True if rainfall is measured
+ */
+func (obs *Observation) IsRaining() bool {
+	return obs.RainStation != "" && obs.Rain > 0
+}
+
+/**
+ * Parsing station observations from Central Weather Bureau
+ */
+func (meteo *cwdMeteo) fetchObservation(dataId string) (*observationWeathers, error) {
+	v := observationWeathers{}
+	raw, err := meteo.download(dataId, func(r io.Reader) error {
+		return decodeXml(r, &v)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	meteo.archive(dataId, v.Sent, raw)
+
+	return &v, nil
+}
+
+/**
+ * Get station observations from the shared dataset cache
+ */
+func (meteo *cwdMeteo) requestObservation(dataId string) (*observationWeathers, error) {
+
+	ttl := meteo.cacheTTL
+	if ttl == 0 || ttl > CWB_OBSERVATION_TTL {
+		ttl = CWB_OBSERVATION_TTL
+	}
+
+	data, err := sharedDatasetCache.get(dataId, ttl, func() (interface{}, *datasetInfo, error) {
+		v, err := meteo.fetchObservation(dataId)
+		if err != nil {
+			return nil, nil, err
+		}
+		return v, nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data.(*observationWeathers), nil
+}
+
+/**
+ * @name elementValue
+ * @brief Get the value of element measured by the station
+ * @param name The element name e.g. TEMP, HUMD
+ * @return float64 The value
+ * @return bool False if the element is absent or the station fails to measure
+ */
+func (station *observationStation) elementValue(name string) (float64, bool) {
+	for _, element := range station.WeatherElements {
+		if element.ElementName != name {
+			continue
+		}
+		value, err := strconv.ParseFloat(element.Value, 64)
+		if err != nil || value <= CWB_MISSING_VALUE {
+			return 0, false
+		}
+		return value, true
+	}
+	return 0, false
+}
+
+func (station *observationStation) parameter(name string) string {
+	for _, param := range station.Parameters {
+		if param.ParameterName == name {
+			return param.ParameterValue
+		}
+	}
+	return ""
+}
+
+/**
+ * @name nearestStation
+ * @brief Find the nearest station which measures the element
+ * @param data The dataset of observations
+ * @param lat The latitude of location
+ * @param lng The longtitude of location
+ * @param element The element the station must measure
+ * @return *observationStation The nearest station
+ * @return float64 The geodesic distance in meters
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func nearestStation(data *observationWeathers, lat float64, lng float64, element string) (*observationStation, float64, error) {
+
+	ellip := ellipsoid.Init("WGS84", ellipsoid.Degrees, ellipsoid.Meter, ellipsoid.LongitudeIsSymmetric, ellipsoid.BearingIsSymmetric)
+
+	var nearest *observationStation
+	var distance float64
+	for index := range data.Stations {
+		station := &data.Stations[index]
+		if _, ok := station.elementValue(element); !ok {
+			continue
+		}
+		d, _ := ellip.To(lat, lng, station.Lat, station.Lon)
+		if nearest == nil || d < distance {
+			nearest = station
+			distance = d
+		}
+	}
+	if nearest == nil {
+		return nil, 0, errors.New("no station measures " + element)
+	}
+
+	return nearest, distance, nil
+}
+
+/**
+ * @name observationOfLatlng
+ * @brief Get observation of the nearest station, and rainfall of the nearest rain gauge
+ * @param data The dataset of weather stations
+ * @param rain The dataset of rain gauges, nil if it is unavailable
+ * @param lat The latitude of location
+ * @param lng The longtitude of location
+ * @param t The reference time to calculate age of observation
+ * @return *Observation The observation
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func observationOfLatlng(data *observationWeathers, rain *observationWeathers, lat float64, lng float64, t time.Time) (*Observation, error) {
+
+	station, distance, err := nearestStation(data, lat, lng, "TEMP")
+	if err != nil {
+		return nil, err
+	}
+
+	obsTime, err := parseCwbTime(station.ObsTime)
+	if err != nil {
+		return nil, err
+	}
+
+	obs := Observation{
+		StationId:   station.StationId,
+		StationName: station.LocationName,
+		County:      station.parameter("CITY"),
+		Distance:    distance,
+		ObsTime:     obsTime,
+		Age:         t.Sub(obsTime),
+	}
+	obs.Temp, obs.TempKnown = station.elementValue("TEMP")
+	if humidity, ok := station.elementValue("HUMD"); ok {
+		// O-A0001 reports relative humidity from 0 to 1
+		obs.Humidity = int(humidity*100 + 0.5)
+		obs.HumidityKnown = true
+	}
+	obs.WindSpeed, obs.WindSpeedKnown = station.elementValue("WDSD")
+	if direction, ok := station.elementValue("WDIR"); ok {
+		obs.WindDirection = int(direction)
+	}
+	if obs.TempKnown && obs.HumidityKnown && obs.WindSpeedKnown {
+		obs.ApparentTemp = math.Floor(ApparentTemperature(obs.Temp, float64(obs.Humidity), obs.WindSpeed)*10+0.5) / 10
+		obs.ApparentTempKnown = true
+	}
+
+	if rain != nil {
+		if gauge, d, err := nearestStation(rain, lat, lng, "RAIN"); err == nil {
+			obs.Rain, _ = gauge.elementValue("RAIN")
+			obs.RainStation = gauge.LocationName
+			obs.RainDistance = d
+		}
+	}
+
+	return &obs, nil
+}
+
+func (meteo *cwdMeteo) getObservation(lat float64, lng float64, t time.Time) (*Observation, error) {
+
+	data, err := meteo.requestObservation(CENTRAL_WEATHER_BUREAU_OBSERVATION_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// rainfall is optional, the observation is still useful without it
+	rain, err := meteo.requestObservation(CENTRAL_WEATHER_BUREAU_RAIN_ID)
+	if err != nil {
+		if meteo.logLevel == 1 {
+			meteo.logger.Println(err)
+		}
+		rain = nil
+	}
+
+	return observationOfLatlng(data, rain, lat, lng, t)
+}
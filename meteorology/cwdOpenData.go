@@ -5,37 +5,64 @@
 package meteorology
 
 import (
-	"bytes"
-	"encoding/json"
 	"encoding/xml"
 	"errors"
-	"fmt"
 	"io"
 	"log"
+	"sort"
 	"strconv"
-	"strings"
 	"time"
-
-	"github.com/xu354cjo1008/eatingFinder/httpHandler"
 )
 
 const (
-	CENTRAL_WEATHER_BUREAU_URL       string = "http://opendata.cwb.gov.tw/opendataapi?dataid=%s&authorizationkey=%s"
-	CENTRAL_WEATHER_BUREAU_DATA_ID_1 string = "F-C0032-002"
+	CENTRAL_WEATHER_BUREAU_URL        string = "http://opendata.cwb.gov.tw/opendataapi?dataid=%s&authorizationkey=%s"
+	CENTRAL_WEATHER_BUREAU_DATA_ID_ZH string = "F-C0032-001"
+	CENTRAL_WEATHER_BUREAU_DATA_ID_EN string = "F-C0032-002"
 )
 
+/**
+ * A time out of every forecast period uses the nearest period within this gap,
+ * e.g. before the first period of a dataset which is just issued
+ */
+const CWB_NEAREST_PERIOD = 12 * time.Hour
+
+/**
+ * @name forecastDataId
+ * @brief Get the dataset of 36 hours forecast in the language
+ * @param language The language e.g. zh-TW, en
+ * @return string The dataset id, F-C0032-001 for zh-TW and F-C0032-002 for others
+ */
+func forecastDataId(language string) string {
+
+	if isChinese(language) {
+		return CENTRAL_WEATHER_BUREAU_DATA_ID_ZH
+	}
+
+	return CENTRAL_WEATHER_BUREAU_DATA_ID_EN
+}
+
 /**
  * The xml structure of weather information from Central Weather Bureau
  * The example xml file is in F-C0032-001.xml and F-C0032-002.xml
  */
 type Weathers struct {
 	XMLName xml.Name `xml:"cwbopendata"`
+	DataId  string   `xml:"dataid"`
 	DataSet dataset  `xml:"dataset"`
 }
 
 type dataset struct {
-	XMLName   xml.Name   `xml:"dataset"`
-	Locations []location `xml:"location"`
+	XMLName     xml.Name        `xml:"dataset"`
+	DatasetInfo datasetInfo     `xml:"datasetInfo"`
+	Locations   []location      `xml:"location"`
+	index       map[*county]int // index of Locations, built by decodeWeathers
+}
+
+type datasetInfo struct {
+	XMLName     xml.Name `xml:"datasetInfo"`
+	Description string   `xml:"datasetDescription"`
+	IssueTime   string   `xml:"issueTime"`
+	Update      string   `xml:"update"`
 }
 
 type location struct {
@@ -64,11 +91,14 @@ type parameter struct {
 }
 
 type cwdMeteo struct {
-	apiKey   string
-	language string
-	logLevel int
-	logger   *log.Logger
-	dataset  dataset
+	apiKey        string
+	language      string
+	cacheTTL      time.Duration
+	archiver      Archiver
+	nowcastDataId string
+	strictPeriod  bool // only the period containing the time, no nearest period e.g. for the past
+	logLevel      int
+	logger        *log.Logger
 }
 
 /**
@@ -84,19 +114,21 @@ func (meteo *cwdMeteo) dataOfLocation(dataset dataset, location string) (*locati
 		return nil, errors.New("invalid location")
 	}
 
-	var buffer bytes.Buffer
+	c, err := findCounty(location)
+	if err != nil {
+		return nil, err
+	}
 
-	// This is a workround to match 台 and 臺
-	if string([]rune(location)[0]) == "台" {
-		buffer.WriteRune('臺')
-		buffer.WriteString(strings.Split(location, "台")[1])
-	} else {
-		buffer.WriteString(location)
+	if dataset.index != nil {
+		if index, ok := dataset.index[c]; ok {
+			return &dataset.Locations[index], nil
+		}
+		return nil, errors.New("can not find data for the location")
 	}
 
-	for _, data := range dataset.Locations {
-		if strings.ToLower(data.LocationName) == strings.ToLower(buffer.String()) {
-			return &data, nil
+	for index, data := range dataset.Locations {
+		if lc, err := findCounty(data.LocationName); err == nil && lc == c {
+			return &dataset.Locations[index], nil
 		}
 	}
 
@@ -113,18 +145,31 @@ func (meteo *cwdMeteo) getElement(dataOflocation location, name string) (*weathe
 	return nil, errors.New("can not find element with related name")
 }
 
+/**
+ * @name getInfoByTime
+ * @brief Find the data of an element in the period [start, end) which contains the time,
+ * the nearest period is used if the time is out of every period by CWB_NEAREST_PERIOD at most,
+ * unless strictPeriod is set
+ * @param element The weather element
+ * @param inTime The time we care about
+ * @return *dataByTime The pointer of data of that period
+ * @return error The Error description, this will be nil if no error occurs
+ */
 func (meteo *cwdMeteo) getInfoByTime(element weatherElement, inTime time.Time) (*dataByTime, error) {
 
 	if meteo.logLevel == 1 {
 		meteo.logger.Println("data time is ", inTime.String())
 	}
 
-	for index, dataOfTime := range element.Time {
-		startTime, err := time.Parse(time.RFC3339, dataOfTime.StartTime)
+	var nearest *dataByTime
+	var gap time.Duration
+	for index := range element.Time {
+		dataOfTime := &element.Time[index]
+		startTime, err := parseCwbTime(dataOfTime.StartTime)
 		if err != nil {
 			return nil, err
 		}
-		endTime, err := time.Parse(time.RFC3339, dataOfTime.EndTime)
+		endTime, err := parseCwbTime(dataOfTime.EndTime)
 		if err != nil {
 			return nil, err
 		}
@@ -134,9 +179,25 @@ func (meteo *cwdMeteo) getInfoByTime(element weatherElement, inTime time.Time) (
 			meteo.logger.Println("element#", index, " end time is ", endTime.String())
 		}
 
-		if inTime.After(startTime) && inTime.Before(endTime) {
-			return &dataOfTime, nil
+		if !inTime.Before(startTime) && inTime.Before(endTime) {
+			return dataOfTime, nil
+		}
+
+		d := startTime.Sub(inTime)
+		if !inTime.Before(endTime) {
+			d = inTime.Sub(endTime)
+		}
+		if nearest == nil || d < gap {
+			nearest = dataOfTime
+			gap = d
+		}
+	}
+
+	if nearest != nil && gap <= CWB_NEAREST_PERIOD && !meteo.strictPeriod {
+		if meteo.logLevel == 1 {
+			meteo.logger.Println("use the nearest period starts at", nearest.StartTime)
 		}
+		return nearest, nil
 	}
 
 	return nil, errors.New("can not find data for that time")
@@ -158,93 +219,205 @@ func (meteo *cwdMeteo) getParameter(location location, time time.Time, name stri
 }
 
 /**
- * Parsing weather information from Central Weather Bureau
- * The example xml file is in F-C0032-001.xml and F-C0032-002.xml
+ * Get weather information of the language from the shared dataset cache,
+ * the dataset is downloaded again only if it is expired
  */
 func (meteo *cwdMeteo) request() (*Weathers, error) {
-	reqUrl := fmt.Sprintf(CENTRAL_WEATHER_BUREAU_URL, CENTRAL_WEATHER_BUREAU_DATA_ID_1, meteo.apiKey)
-	resp, err := httpHandler.HttpGet(reqUrl)
+
+	dataId := forecastDataId(meteo.language)
+	data, err := sharedDatasetCache.get(dataId, meteo.cacheTTL, func() (interface{}, *datasetInfo, error) {
+		v, err := meteo.fetch(dataId)
+		if err != nil {
+			return nil, nil, err
+		}
+		return v, &v.DataSet.DatasetInfo, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	v := Weathers{}
-	err = xml.Unmarshal(resp, &v)
+	return data.(*Weathers), nil
+}
+
+/**
+ * Parsing weather information from Central Weather Bureau
+ * The example xml file is in F-C0032-001.xml and F-C0032-002.xml
+ */
+func (meteo *cwdMeteo) fetch(dataId string) (*Weathers, error) {
+	var v *Weathers
+	raw, err := meteo.download(dataId, func(r io.Reader) (err error) {
+		v, err = decodeWeathers(r)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	meteo.archive(dataId, v.DataSet.DatasetInfo.IssueTime, raw)
+
 	if meteo.logLevel == 1 {
-		t, _ := json.MarshalIndent(v, "", "  ")
-		meteo.logger.Println("request raw data", string(t))
+		meteo.logger.Println("request", dataId, "issued at", v.DataSet.DatasetInfo.IssueTime, "with", len(v.DataSet.Locations), "locations")
 	}
 
-	return &v, nil
+	return v, nil
 }
 
-func (meteo *cwdMeteo) transformCIToEnum(desc string) int {
-
-	CIMap := map[string]int{
-		"COMFORTABLE": CI_COMFORTABLE,
-		"HOT":         CI_HOT,
-	}
-
-	res := 0
+/**
+ * @name getInfoByStartTime
+ * @brief Find the data of an element which starts at the same time as other element
+ * @param element The weather element
+ * @param startTime The start time string from xml
+ * @return *dataByTime The pointer of data with related start time
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *cwdMeteo) getInfoByStartTime(element weatherElement, startTime string) (*dataByTime, error) {
 
-	for index, ci := range CIMap {
-		if strings.Contains(desc, index) {
-			res += ci
+	for _, dataOfTime := range element.Time {
+		if dataOfTime.StartTime == startTime {
+			return &dataOfTime, nil
 		}
 	}
 
-	return res
+	return nil, errors.New("can not find data for that start time")
 }
 
-func (meteo *cwdMeteo) getWeather(location string, time time.Time) (*Weather, error) {
+/**
+ * @name weatherOfPeriod
+ * @brief Collect Wx, MaxT, MinT, CI and PoP of the period starts at startTime
+ * @param location The location data from xml
+ * @param startTime The start time string of the period
+ * @return *Weather The weather of that period
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *cwdMeteo) weatherOfPeriod(location location, startTime string) (*Weather, error) {
 
-	weatherData, err := meteo.request()
+	params := make(map[string]*dataByTime)
+	for _, name := range []string{"Wx", "MaxT", "MinT", "CI", "PoP"} {
+		element, err := meteo.getElement(location, name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := meteo.getInfoByStartTime(*element, startTime)
+		if err != nil {
+			return nil, err
+		}
+		params[name] = data
+	}
+
+	maxTemp, err := strconv.Atoi(params["MaxT"].Parameter.Name)
 	if err != nil {
 		return nil, err
 	}
-
-	dataOfLocation, err := meteo.dataOfLocation(weatherData.DataSet, location)
+	minTemp, err := strconv.Atoi(params["MinT"].Parameter.Name)
+	if err != nil {
+		return nil, err
+	}
+	probOfprecip, err := strconv.Atoi(params["PoP"].Parameter.Name)
 	if err != nil {
 		return nil, err
 	}
+	ci, minComfort, maxComfort := transformCIToEnum(params["CI"].Parameter.Name)
 
-	wx, err := meteo.getParameter(*dataOfLocation, time, "Wx")
+	weather := Weather{
+		Wx:           decodeWx(params["Wx"].Parameter.Name, params["Wx"].Parameter.Value),
+		MaxTemp:      maxTemp,
+		MinTemp:      minTemp,
+		ComfortIndex: ci,
+		MinComfort:   minComfort,
+		MaxComfort:   maxComfort,
+		Pop:          probOfprecip,
+	}
+
+	return &weather, nil
+}
+
+/**
+ * @name forecastOfLocation
+ * @brief Build every forecast period of the location which overlaps [from, to)
+ * @param location The location data from xml
+ * @param from The begin of the time range
+ * @param to The end of the time range
+ * @return []Forecast The forecast periods ordered by start time
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *cwdMeteo) forecastOfLocation(location location, from time.Time, to time.Time) ([]Forecast, error) {
+
+	wx, err := meteo.getElement(location, "Wx")
 	if err != nil {
 		return nil, err
 	}
-	maxT, err := meteo.getParameter(*dataOfLocation, time, "MaxT")
+
+	forecasts := []Forecast{}
+	for _, dataOfTime := range wx.Time {
+		startTime, err := parseCwbTime(dataOfTime.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		endTime, err := parseCwbTime(dataOfTime.EndTime)
+		if err != nil {
+			return nil, err
+		}
+
+		if !startTime.Before(to) || !endTime.After(from) {
+			continue
+		}
+
+		weather, err := meteo.weatherOfPeriod(location, dataOfTime.StartTime)
+		if err != nil {
+			return nil, err
+		}
+
+		forecasts = append(forecasts, Forecast{
+			StartTime: startTime,
+			EndTime:   endTime,
+			Weather:   *weather,
+		})
+	}
+
+	if len(forecasts) == 0 {
+		return nil, errors.New("can not find data for that time range")
+	}
+
+	sort.Slice(forecasts, func(i, j int) bool {
+		return forecasts[i].StartTime.Before(forecasts[j].StartTime)
+	})
+
+	return forecasts, nil
+}
+
+func (meteo *cwdMeteo) getWeather(location string, time time.Time) (*Weather, error) {
+
+	weatherData, err := meteo.request()
 	if err != nil {
 		return nil, err
 	}
-	minT, err := meteo.getParameter(*dataOfLocation, time, "MinT")
+
+	dataOfLocation, err := meteo.dataOfLocation(weatherData.DataSet, location)
 	if err != nil {
 		return nil, err
 	}
-	ci, err := meteo.getParameter(*dataOfLocation, time, "CI")
+
+	wx, err := meteo.getParameter(*dataOfLocation, time, "Wx")
 	if err != nil {
 		return nil, err
 	}
-	pop, err := meteo.getParameter(*dataOfLocation, time, "PoP")
+
+	return meteo.weatherOfPeriod(*dataOfLocation, wx.StartTime)
+}
+
+func (meteo *cwdMeteo) getForecast(location string, from time.Time, to time.Time) ([]Forecast, error) {
+
+	weatherData, err := meteo.request()
 	if err != nil {
 		return nil, err
 	}
 
-	maxTemp, err := strconv.Atoi(maxT.Parameter.Name)
-	minTemp, err := strconv.Atoi(minT.Parameter.Name)
-	probOfprecip, err := strconv.Atoi(pop.Parameter.Name)
-	weather := Weather{
-		weather:      transformWxToEnum(wx.Parameter.Name),
-		maxTemp:      maxTemp,
-		minTemp:      minTemp,
-		comfortIndex: meteo.transformCIToEnum(ci.Parameter.Name),
-		pop:          probOfprecip,
+	dataOfLocation, err := meteo.dataOfLocation(weatherData.DataSet, location)
+	if err != nil {
+		return nil, err
 	}
 
-	return &weather, nil
+	return meteo.forecastOfLocation(*dataOfLocation, from, to)
 }
 
 func newCwdMeteo(apiKey string, language string, logFile io.Writer) *cwdMeteo {
@@ -0,0 +1,321 @@
+/****************************************************************************
+ * This file is xml parser for township forecast from Central Weather Bureau*
+ * The example xml file is in F-D0047-061.xml                               *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * The period of each township forecast
+ */
+const CWB_TOWNSHIP_PERIOD = 3 * time.Hour
+
+/**
+ * The xml structure of township forecast from Central Weather Bureau
+ */
+type townshipWeathers struct {
+	XMLName xml.Name        `xml:"cwbopendata"`
+	DataId  string          `xml:"dataid"`
+	DataSet townshipDataset `xml:"dataset"`
+}
+
+type townshipDataset struct {
+	XMLName     xml.Name          `xml:"dataset"`
+	DatasetInfo datasetInfo       `xml:"datasetInfo"`
+	Locations   townshipLocations `xml:"locations"`
+}
+
+type townshipLocations struct {
+	XMLName       xml.Name           `xml:"locations"`
+	LocationsName string             `xml:"locationsName"`
+	Locations     []townshipLocation `xml:"location"`
+}
+
+type townshipLocation struct {
+	XMLName         xml.Name          `xml:"location"`
+	LocationName    string            `xml:"locationName"`
+	Geocode         string            `xml:"geocode"`
+	Lat             float64           `xml:"lat"`
+	Lon             float64           `xml:"lon"`
+	WeatherElements []townshipElement `xml:"weatherElement"`
+}
+
+type townshipElement struct {
+	XMLName     xml.Name       `xml:"weatherElement"`
+	ElementName string         `xml:"elementName"`
+	Time        []townshipTime `xml:"time"`
+}
+
+/**
+ * Data of one time, DataTime is used for point data e.g. T, AT, RH
+ * and StartTime, EndTime are used for period data e.g. Wx, PoP6h
+ */
+type townshipTime struct {
+	XMLName       xml.Name       `xml:"time"`
+	DataTime      string         `xml:"dataTime"`
+	StartTime     string         `xml:"startTime"`
+	EndTime       string         `xml:"endTime"`
+	ElementValues []elementValue `xml:"elementValue"`
+}
+
+type elementValue struct {
+	XMLName  xml.Name `xml:"elementValue"`
+	Value    string   `xml:"value"`
+	Measures string   `xml:"measures"`
+}
+
+/**
+ * Parsing township forecast from Central Weather Bureau
+ */
+func (meteo *cwdMeteo) fetchTownship(dataId string) (*townshipWeathers, error) {
+	v := townshipWeathers{}
+	raw, err := meteo.download(dataId, func(r io.Reader) error {
+		return decodeXml(r, &v)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	meteo.archive(dataId, v.DataSet.DatasetInfo.IssueTime, raw)
+
+	if meteo.logLevel == 1 {
+		meteo.logger.Println("request", dataId, "with", len(v.DataSet.Locations.Locations), "townships")
+	}
+
+	return &v, nil
+}
+
+/**
+ * Get township forecast from the shared dataset cache
+ */
+func (meteo *cwdMeteo) requestTownship(dataId string) (*townshipWeathers, error) {
+
+	data, err := sharedDatasetCache.get(dataId, meteo.cacheTTL, func() (interface{}, *datasetInfo, error) {
+		v, err := meteo.fetchTownship(dataId)
+		if err != nil {
+			return nil, nil, err
+		}
+		return v, &v.DataSet.DatasetInfo, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data.(*townshipWeathers), nil
+}
+
+/**
+ * @name townshipOfDataset
+ * @brief Find township forecast by the name of township
+ * @param data The dataset of one county
+ * @param township The township e.g. 信義區
+ * @return *townshipLocation The township data from xml
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *cwdMeteo) townshipOfDataset(data *townshipWeathers, township string) (*townshipLocation, error) {
+
+	name := strings.ToLower(strings.Replace(strings.TrimSpace(township), "台", "臺", -1))
+	if name == "" {
+		return nil, errors.New("invalid township")
+	}
+
+	for index, location := range data.DataSet.Locations.Locations {
+		if strings.ToLower(location.LocationName) == name {
+			return &data.DataSet.Locations.Locations[index], nil
+		}
+	}
+
+	return nil, errors.New("can not find data for the township")
+}
+
+/**
+ * @name townshipValues
+ * @brief Get values of the element at the time
+ * @param location The township data from xml
+ * @param name The element name e.g. T, Wx, PoP6h
+ * @param t The time, point data must be at the time and period data must cover it
+ * @return []elementValue The values
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *cwdMeteo) townshipValues(location townshipLocation, name string, t time.Time) ([]elementValue, error) {
+
+	for _, element := range location.WeatherElements {
+		if element.ElementName != name {
+			continue
+		}
+		for _, dataOfTime := range element.Time {
+			if dataOfTime.DataTime != "" {
+				dataTime, err := parseCwbTime(dataOfTime.DataTime)
+				if err != nil {
+					return nil, err
+				}
+				if dataTime.Equal(t) {
+					return dataOfTime.ElementValues, nil
+				}
+				continue
+			}
+			startTime, err := parseCwbTime(dataOfTime.StartTime)
+			if err != nil {
+				return nil, err
+			}
+			endTime, err := parseCwbTime(dataOfTime.EndTime)
+			if err != nil {
+				return nil, err
+			}
+			if !t.Before(startTime) && t.Before(endTime) {
+				return dataOfTime.ElementValues, nil
+			}
+		}
+		return nil, errors.New("can not find data of " + name + " for that time")
+	}
+
+	return nil, errors.New("can not find element with related name")
+}
+
+/**
+ * Get the first value of the element at the time as integer
+ */
+func (meteo *cwdMeteo) townshipInt(location townshipLocation, name string, t time.Time) (int, error) {
+
+	values, err := meteo.townshipValues(location, name, t)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, errors.New("empty value of " + name)
+	}
+
+	return strconv.Atoi(strings.TrimSpace(values[0].Value))
+}
+
+/**
+ * @name windSpeedOfValues
+ * @brief Get wind speed in m/s, WS is given in both m/s and Beaufort scale
+ * @param values The values of WS
+ * @return float64 The wind speed in m/s, 0 if it is not given
+ */
+func windSpeedOfValues(values []elementValue) float64 {
+
+	for _, value := range values {
+		if value.Measures != "公尺/秒" && value.Measures != "m/s" {
+			continue
+		}
+		// calm wind is written as "≤ 1"
+		speed, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(value.Value, "≤")), 64)
+		if err == nil {
+			return speed
+		}
+	}
+
+	return 0
+}
+
+/**
+ * @name townshipForecast
+ * @brief Build every 3 hours forecast of the township which overlaps [from, to)
+ * @param location The township data from xml
+ * @param from The begin of the time range
+ * @param to The end of the time range
+ * @return []Forecast The forecast periods ordered by start time
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *cwdMeteo) townshipForecast(location townshipLocation, from time.Time, to time.Time) ([]Forecast, error) {
+
+	var temps *townshipElement
+	for index, element := range location.WeatherElements {
+		if element.ElementName == "T" {
+			temps = &location.WeatherElements[index]
+		}
+	}
+	if temps == nil {
+		return nil, errors.New("can not find temperature of the township")
+	}
+
+	forecasts := []Forecast{}
+	for _, dataOfTime := range temps.Time {
+		startTime, err := parseCwbTime(dataOfTime.DataTime)
+		if err != nil {
+			return nil, err
+		}
+		endTime := startTime.Add(CWB_TOWNSHIP_PERIOD)
+		if !startTime.Before(to) || !endTime.After(from) {
+			continue
+		}
+
+		temp, err := meteo.townshipInt(location, "T", startTime)
+		if err != nil {
+			return nil, err
+		}
+		weather := Weather{MaxTemp: temp, MinTemp: temp, Temp: temp, TempKnown: true}
+
+		// elements below are optional in some datasets
+		if values, err := meteo.townshipValues(location, "Wx", startTime); err == nil && len(values) > 0 {
+			code := 0
+			if len(values) > 1 {
+				code, _ = strconv.Atoi(values[1].Value)
+			}
+			weather.Wx = decodeWx(values[0].Value, code)
+		}
+		for _, name := range []string{"PoP6h", "PoP12h", "PoP3h"} {
+			if pop, err := meteo.townshipInt(location, name, startTime); err == nil {
+				weather.Pop = pop
+				break
+			}
+		}
+		if at, err := meteo.townshipInt(location, "AT", startTime); err == nil {
+			weather.ApparentTemp, weather.ApparentTempKnown = at, true
+		}
+		if rh, err := meteo.townshipInt(location, "RH", startTime); err == nil {
+			weather.Humidity = rh
+		}
+		if values, err := meteo.townshipValues(location, "WS", startTime); err == nil {
+			weather.WindSpeed = windSpeedOfValues(values)
+		}
+		if uvi, err := meteo.townshipInt(location, "UVI", startTime); err == nil {
+			weather.UVIndex = uvi
+		}
+		if values, err := meteo.townshipValues(location, "CI", startTime); err == nil && len(values) > 0 {
+			weather.ComfortIndex, weather.MinComfort, weather.MaxComfort = transformCIToEnum(values[0].Value)
+		}
+
+		forecasts = append(forecasts, Forecast{
+			StartTime: startTime,
+			EndTime:   endTime,
+			Weather:   weather,
+		})
+	}
+
+	if len(forecasts) == 0 {
+		return nil, errors.New("can not find data for that time range")
+	}
+
+	return forecasts, nil
+}
+
+func (meteo *cwdMeteo) getTownshipForecast(countyName string, township string, from time.Time, to time.Time) ([]Forecast, error) {
+
+	c, err := findCounty(countyName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := meteo.requestTownship(c.townshipDataId)
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := meteo.townshipOfDataset(data, township)
+	if err != nil {
+		return nil, err
+	}
+
+	return meteo.townshipForecast(*location, from, to)
+}
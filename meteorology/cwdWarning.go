@@ -0,0 +1,300 @@
+/****************************************************************************
+ * This file is xml parser for weather warnings from Central Weather Bureau *
+ * The example xml file is in W-C0033-001.xml                               *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	CENTRAL_WEATHER_BUREAU_WARNING_ID_ZH string = "W-C0033-001"
+	CENTRAL_WEATHER_BUREAU_WARNING_ID_EN string = "W-C0033-002"
+)
+
+/**
+ * Warnings are issued at any time, so they are cached for a short time
+ */
+const CWB_WARNING_TTL = 10 * time.Minute
+
+/**
+ * Severity of warning
+ */
+const (
+	WARN_SEVERITY_MINOR = iota + 1
+	WARN_SEVERITY_MODERATE
+	WARN_SEVERITY_SEVERE
+	WARN_SEVERITY_EXTREME
+)
+
+/**
+ * Kind of warning
+ */
+const (
+	WARN_TYPHOON    string = "typhoon"
+	WARN_HEAVY_RAIN string = "heavyRain"
+	WARN_HEAT       string = "heat"
+	WARN_COLD       string = "cold"
+	WARN_WIND       string = "wind"
+	WARN_FOG        string = "fog"
+	WARN_OTHER      string = "other"
+)
+
+type warningKind struct {
+	kind     string
+	severity int
+}
+
+/**
+ * Phenomena in zh-TW and en datasets
+ * Phenomena containing another one must be listed before it.
+ */
+var warningPhenomena = []struct {
+	phenomena string
+	kind      warningKind
+}{
+	{"颱風", warningKind{WARN_TYPHOON, WARN_SEVERITY_SEVERE}},
+	{"TYPHOON", warningKind{WARN_TYPHOON, WARN_SEVERITY_SEVERE}},
+	{"超大豪雨", warningKind{WARN_HEAVY_RAIN, WARN_SEVERITY_EXTREME}},
+	{"大豪雨", warningKind{WARN_HEAVY_RAIN, WARN_SEVERITY_SEVERE}},
+	{"豪雨", warningKind{WARN_HEAVY_RAIN, WARN_SEVERITY_SEVERE}},
+	{"大雨", warningKind{WARN_HEAVY_RAIN, WARN_SEVERITY_MODERATE}},
+	{"EXTREMELY TORRENTIAL RAIN", warningKind{WARN_HEAVY_RAIN, WARN_SEVERITY_EXTREME}},
+	{"TORRENTIAL RAIN", warningKind{WARN_HEAVY_RAIN, WARN_SEVERITY_SEVERE}},
+	{"EXTREMELY HEAVY RAIN", warningKind{WARN_HEAVY_RAIN, WARN_SEVERITY_SEVERE}},
+	{"HEAVY RAIN", warningKind{WARN_HEAVY_RAIN, WARN_SEVERITY_MODERATE}},
+	{"高溫", warningKind{WARN_HEAT, WARN_SEVERITY_MODERATE}},
+	{"HIGH TEMPERATURE", warningKind{WARN_HEAT, WARN_SEVERITY_MODERATE}},
+	{"低溫", warningKind{WARN_COLD, WARN_SEVERITY_MODERATE}},
+	{"LOW TEMPERATURE", warningKind{WARN_COLD, WARN_SEVERITY_MODERATE}},
+	{"強風", warningKind{WARN_WIND, WARN_SEVERITY_MODERATE}},
+	{"STRONG WIND", warningKind{WARN_WIND, WARN_SEVERITY_MODERATE}},
+	{"濃霧", warningKind{WARN_FOG, WARN_SEVERITY_MINOR}},
+	{"FOG", warningKind{WARN_FOG, WARN_SEVERITY_MINOR}},
+}
+
+/**
+ * The xml structure of warnings from Central Weather Bureau
+ */
+type warningWeathers struct {
+	XMLName xml.Name       `xml:"cwbopendata"`
+	DataId  string         `xml:"dataid"`
+	DataSet warningDataset `xml:"dataset"`
+}
+
+type warningDataset struct {
+	XMLName     xml.Name          `xml:"dataset"`
+	DatasetInfo datasetInfo       `xml:"datasetInfo"`
+	Locations   []warningLocation `xml:"location"`
+}
+
+type warningLocation struct {
+	XMLName      xml.Name `xml:"location"`
+	LocationName string   `xml:"locationName"`
+	Geocode      string   `xml:"geocode"`
+	Hazards      []hazard `xml:"hazardConditions>hazards>hazard"`
+}
+
+type hazard struct {
+	XMLName      xml.Name `xml:"hazard"`
+	Language     string   `xml:"info>language"`
+	Phenomena    string   `xml:"info>phenomena"`
+	Significance string   `xml:"info>significance"`
+	StartTime    string   `xml:"validTime>startTime"`
+	EndTime      string   `xml:"validTime>endTime"`
+}
+
+/**
+ * Weather warning of one county
+ */
+type Warning struct {
+	County       string    `json:"county" bson:"county"`
+	Kind         string    `json:"kind" bson:"kind"`
+	Phenomena    string    `json:"phenomena" bson:"phenomena"`       // e.g. 颱風, 豪雨
+	Significance string    `json:"significance" bson:"significance"` // e.g. 警報, 特報
+	Severity     int       `json:"severity" bson:"severity"`
+	StartTime    time.Time `json:"startTime" bson:"startTime"`
+	EndTime      time.Time `json:"endTime" bson:"endTime"`
+}
+
+/**
+ * @name IsActive
+ * @brief Check if the warning is in effect at the time
+ * @param t The time
+ * @return bool True if the time is in [StartTime, EndTime)
+ */
+func (warning *Warning) IsActive(t time.Time) bool {
+	return !t.Before(warning.StartTime) && t.Before(warning.EndTime)
+}
+
+/**
+ * @name classifyWarning
+ * @brief Get the kind and severity of warning
+ * A warning (警報) is more severe than an advisory (特報), and
+ * information (資訊) is less severe.
+ * @param phenomena The phenomena e.g. 颱風, HEAVY RAIN
+ * @param significance The significance e.g. 警報, 特報, WARNING
+ * @return string The kind of warning
+ * @return int The severity
+ */
+func classifyWarning(phenomena string, significance string) (string, int) {
+
+	kind := warningKind{WARN_OTHER, WARN_SEVERITY_MINOR}
+	upper := strings.ToUpper(phenomena)
+	for _, p := range warningPhenomena {
+		if strings.Contains(upper, p.phenomena) {
+			kind = p.kind
+			break
+		}
+	}
+
+	significance = strings.ToUpper(significance)
+	switch {
+	case significance == "警報" || significance == "WARNING":
+		if kind.severity < WARN_SEVERITY_EXTREME {
+			kind.severity++
+		}
+	case significance == "資訊" || significance == "INFORMATION":
+		if kind.severity > WARN_SEVERITY_MINOR {
+			kind.severity--
+		}
+	}
+
+	return kind.kind, kind.severity
+}
+
+/**
+ * Parsing warnings from Central Weather Bureau
+ */
+func (meteo *cwdMeteo) fetchWarning(dataId string) (*warningWeathers, error) {
+	v := warningWeathers{}
+	raw, err := meteo.download(dataId, func(r io.Reader) error {
+		return decodeXml(r, &v)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	meteo.archive(dataId, v.DataSet.DatasetInfo.IssueTime, raw)
+
+	return &v, nil
+}
+
+/**
+ * Get warnings from the shared dataset cache
+ */
+func (meteo *cwdMeteo) requestWarning() (*warningWeathers, error) {
+
+	dataId := CENTRAL_WEATHER_BUREAU_WARNING_ID_EN
+	if isChinese(meteo.language) {
+		dataId = CENTRAL_WEATHER_BUREAU_WARNING_ID_ZH
+	}
+
+	ttl := meteo.cacheTTL
+	if ttl == 0 || ttl > CWB_WARNING_TTL {
+		ttl = CWB_WARNING_TTL
+	}
+
+	data, err := sharedDatasetCache.get(dataId, ttl, func() (interface{}, *datasetInfo, error) {
+		v, err := meteo.fetchWarning(dataId)
+		if err != nil {
+			return nil, nil, err
+		}
+		return v, &v.DataSet.DatasetInfo, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data.(*warningWeathers), nil
+}
+
+/**
+ * @name warningsOfCounty
+ * @brief Get warnings of the county which are in effect at the time
+ * @param data The dataset of warnings
+ * @param countyName The county e.g. 臺北市, Taipei City
+ * @param t The time
+ * @return []Warning The active warnings, the most severe one is the first
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *cwdMeteo) warningsOfCounty(data *warningWeathers, countyName string, t time.Time) ([]Warning, error) {
+
+	c, err := findCounty(countyName)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := []Warning{}
+	for _, location := range data.DataSet.Locations {
+		if lc, err := findCounty(location.LocationName); err != nil || lc != c {
+			continue
+		}
+		for _, h := range location.Hazards {
+			startTime, err := parseCwbTime(h.StartTime)
+			if err != nil {
+				return nil, err
+			}
+			endTime, err := parseCwbTime(h.EndTime)
+			if err != nil {
+				return nil, err
+			}
+			kind, severity := classifyWarning(h.Phenomena, h.Significance)
+			warning := Warning{
+				County:       location.LocationName,
+				Kind:         kind,
+				Phenomena:    h.Phenomena,
+				Significance: h.Significance,
+				Severity:     severity,
+				StartTime:    startTime,
+				EndTime:      endTime,
+			}
+			if !warning.IsActive(t) {
+				continue
+			}
+			warnings = append(warnings, warning)
+		}
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Severity > warnings[j].Severity
+	})
+
+	return warnings, nil
+}
+
+func (meteo *cwdMeteo) getWarnings(county string, t time.Time) ([]Warning, error) {
+
+	data, err := meteo.requestWarning()
+	if err != nil {
+		return nil, err
+	}
+
+	return meteo.warningsOfCounty(data, county, t)
+}
+
+/**
+ * @name HasWarning
+ * @brief Check if there is a warning of the kind in the list
+ * @param warnings The warnings
+ * @param kind The kind e.g. WARN_TYPHOON
+ * @return bool True if there is one
+ */
+func HasWarning(warnings []Warning, kind string) bool {
+
+	for _, warning := range warnings {
+		if warning.Kind == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+var errNoWarningSource = errors.New("no meteorology source supports warnings")
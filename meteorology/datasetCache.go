@@ -0,0 +1,143 @@
+/****************************************************************************
+ * This file is the cache of datasets from Central Weather Bureau.          *
+ * The datasets are shared by every cwdMeteo in the process.                *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"sync"
+	"time"
+)
+
+/**
+ * CWB issues F-C0032 datasets every 6 hours, a dataset is refreshed after
+ * the next issue time. If the new dataset is late, it is retried later.
+ */
+const (
+	CWB_ISSUE_INTERVAL = 6 * time.Hour
+	CWB_RETRY_INTERVAL = 10 * time.Minute
+)
+
+type cachedDataset struct {
+	mutex     sync.Mutex
+	data      interface{}
+	fetchedAt time.Time
+	expireAt  time.Time // refresh time by issue time of dataset
+}
+
+type datasetCache struct {
+	mutex   sync.Mutex
+	entries map[string]*cachedDataset
+}
+
+var sharedDatasetCache = newDatasetCache()
+
+/**
+ * @name expireTime
+ * @brief Calculate when the dataset should be refreshed by issue time,
+ * the time to live of callers is checked by fresh
+ * @param info The information of dataset
+ * @param now The time the dataset is fetched
+ * @return time.Time The expire time
+ */
+func (cache *datasetCache) expireTime(info *datasetInfo, now time.Time) time.Time {
+
+	if info == nil {
+		return now.Add(CWB_RETRY_INTERVAL)
+	}
+
+	issueTime, err := parseCwbTime(info.IssueTime)
+	if err != nil {
+		issueTime, err = parseCwbTime(info.Update)
+	}
+	if err != nil {
+		return now.Add(CWB_RETRY_INTERVAL)
+	}
+
+	expireAt := issueTime.Add(CWB_ISSUE_INTERVAL)
+	if !expireAt.After(now) {
+		return now.Add(CWB_RETRY_INTERVAL)
+	}
+
+	return expireAt
+}
+
+/**
+ * @name fresh
+ * @brief Check if the dataset can be used by the caller, the expiry is of the caller's
+ * time to live, so callers with different TTL share one dataset
+ * @param now The current time
+ * @param ttl The time to live, 0 to refresh by issue time of dataset
+ * @return bool True if the dataset is not expired
+ */
+func (entry *cachedDataset) fresh(now time.Time, ttl time.Duration) bool {
+
+	if entry.data == nil {
+		return false
+	}
+	if ttl > 0 {
+		return now.Before(entry.fetchedAt.Add(ttl))
+	}
+
+	return now.Before(entry.expireAt)
+}
+
+/**
+ * @name get
+ * @brief Get the dataset from cache, fetch it if it is absent or expired
+ * Concurrent callers of the same dataset wait for one fetch.
+ * @param key The key of dataset e.g. dataid
+ * @param ttl The time to live, 0 to refresh by issue time of dataset
+ * @param fetch The function to fetch the dataset and its information
+ * @return interface{} The dataset, callers must not modify it
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (cache *datasetCache) get(key string, ttl time.Duration, fetch func() (interface{}, *datasetInfo, error)) (interface{}, error) {
+
+	cache.mutex.Lock()
+	entry, ok := cache.entries[key]
+	if !ok {
+		entry = &cachedDataset{}
+		cache.entries[key] = entry
+	}
+	cache.mutex.Unlock()
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	now := time.Now()
+	if entry.fresh(now, ttl) {
+		return entry.data, nil
+	}
+
+	data, info, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	entry.data = data
+	entry.fetchedAt = now
+	entry.expireAt = cache.expireTime(info, now)
+
+	return data, nil
+}
+
+/**
+ * Remove every dataset in cache
+ */
+func (cache *datasetCache) clear() {
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries = make(map[string]*cachedDataset)
+}
+
+func newDatasetCache() *datasetCache {
+
+	cache := datasetCache{
+		entries: make(map[string]*cachedDataset),
+	}
+
+	return &cache
+}
@@ -0,0 +1,176 @@
+/****************************************************************************
+ * This file is handler for CWB xml snapshot stored in local file system.   *
+ * The example snapshots are F-C0032-001.xml and F-C0032-002.xml            *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileMeteo struct {
+	path     string
+	language string
+	clock    Clock
+	logLevel int
+	logger   *log.Logger
+	parser   *cwdMeteo
+}
+
+/**
+ * @name snapshotFile
+ * @brief Get the snapshot file, a folder is resolved by the dataset id of language
+ * @return string The path of snapshot file
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *fileMeteo) snapshotFile() (string, error) {
+
+	if meteo.path == "" {
+		return "", errors.New("invalid snapshot path")
+	}
+
+	info, err := os.Stat(meteo.path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return meteo.path, nil
+	}
+
+	return filepath.Join(meteo.path, forecastDataId(meteo.language)+".xml"), nil
+}
+
+/**
+ * Load the snapshot with the same structure as response of Central Weather Bureau
+ */
+func (meteo *fileMeteo) load() (*Weathers, error) {
+
+	file, err := meteo.snapshotFile()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	v, err := decodeWeathers(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if meteo.logLevel == 1 {
+		meteo.logger.Println("load snapshot", file, "issued at", v.DataSet.DatasetInfo.IssueTime)
+	}
+
+	return v, nil
+}
+
+/**
+ * @name snapshotTime
+ * @brief Map the requested time onto the snapshot, as if the snapshot is issued now
+ * @param data The snapshot
+ * @param t The requested time
+ * @return time.Time The related time in the snapshot
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *fileMeteo) snapshotTime(data *Weathers, t time.Time) (time.Time, error) {
+
+	issueTime, err := parseCwbTime(data.DataSet.DatasetInfo.IssueTime)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return issueTime.Add(t.Sub(meteo.clock.Now())), nil
+}
+
+/**
+ * The snapshot is usually issued a little before its first period,
+ * so the period in effect at that time or the upcoming one is used.
+ */
+func (meteo *fileMeteo) getWeather(location string, t time.Time) (*Weather, error) {
+
+	data, err := meteo.load()
+	if err != nil {
+		return nil, err
+	}
+
+	dataOfLocation, err := meteo.parser.dataOfLocation(data.DataSet, location)
+	if err != nil {
+		return nil, err
+	}
+
+	refTime, err := meteo.snapshotTime(data, t)
+	if err != nil {
+		return nil, err
+	}
+
+	wx, err := meteo.parser.getElement(*dataOfLocation, "Wx")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dataOfTime := range wx.Time {
+		endTime, err := parseCwbTime(dataOfTime.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		if endTime.After(refTime) {
+			return meteo.parser.weatherOfPeriod(*dataOfLocation, dataOfTime.StartTime)
+		}
+	}
+
+	return nil, errors.New("can not find data for that time in snapshot")
+}
+
+/**
+ * The periods are returned with the time of the snapshot
+ */
+func (meteo *fileMeteo) getForecast(location string, from time.Time, to time.Time) ([]Forecast, error) {
+
+	data, err := meteo.load()
+	if err != nil {
+		return nil, err
+	}
+
+	dataOfLocation, err := meteo.parser.dataOfLocation(data.DataSet, location)
+	if err != nil {
+		return nil, err
+	}
+
+	refFrom, err := meteo.snapshotTime(data, from)
+	if err != nil {
+		return nil, err
+	}
+
+	return meteo.parser.forecastOfLocation(*dataOfLocation, refFrom, refFrom.Add(to.Sub(from)))
+}
+
+func newFileMeteo(path string, language string, logFile io.Writer) *fileMeteo {
+
+	var loggingLevel int
+	if logFile == nil {
+		loggingLevel = 0
+	} else {
+		loggingLevel = 1
+	}
+
+	meteo := fileMeteo{
+		path:     path,
+		language: language,
+		clock:    SystemClock,
+		logLevel: loggingLevel,
+		logger: log.New(logFile, "FileMeteo: ",
+			log.Ldate|log.Ltime|log.Lshortfile),
+		parser: newCwdMeteo("", language, logFile),
+	}
+
+	return &meteo
+}
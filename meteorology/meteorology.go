@@ -5,8 +5,10 @@
 package meteorology
 
 import (
+	"errors"
 	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -30,75 +32,435 @@ const (
 	WX_AFTERNOON
 )
 
+/**
+ * enum bitmap of comfort index
+ * e.g. 0001 0001 means comfortable to hot
+ */
 const (
 	CI_COMFORTABLE = 1 << iota
 	CI_HOT
+	CI_VERY_COLD
+	CI_COLD
+	CI_CHILLY
+	CI_VERY_HOT
+)
+
+/**
+ * The source of weather information
+ */
+const (
+	METEO_SOURCE_CWB  string = "cwb"
+	METEO_SOURCE_OWM  string = "owm"
+	METEO_SOURCE_FILE string = "file"
 )
 
 type meteorology interface {
 	getWeather(string, time.Time) (*Weather, error)
+	getForecast(string, time.Time, time.Time) ([]Forecast, error)
+}
+
+/**
+ * Interface of source which supports township forecast
+ */
+type townshipMeteorology interface {
+	getTownshipForecast(string, string, time.Time, time.Time) ([]Forecast, error)
+}
+
+/**
+ * Interface of source which supports weather warnings
+ */
+type warningMeteorology interface {
+	getWarnings(string, time.Time) ([]Warning, error)
+}
+
+/**
+ * Interface of source which supports station observations
+ */
+type observationMeteorology interface {
+	getObservation(float64, float64, time.Time) (*Observation, error)
+}
+
+/**
+ * Interface of source which supports rain nowcast
+ */
+type nowcastMeteorology interface {
+	getNowcast(float64, float64, time.Time) (*Nowcast, error)
 }
 
 type Meteorology struct {
-	meteoHandler meteorology
-	apiKey       string
-	language     string
+	providers []*meteoProvider
+	mutex     sync.Mutex
+	apiKey    string
+	language  string
+	clock     Clock
+}
+
+/**
+ * Configuration to create Meteorology
+ */
+type Config struct {
+	Source        string        // cwb, owm or file
+	Sources       []string      // sources to fall through in order, Source is used if empty
+	ApiKey        string        // api key of Central Weather Bureau
+	OwmApiKey     string        // api key of openWeatherMap
+	OwmUrl        string        // base url of openWeatherMap, empty to use the default one
+	Language      string        // language e.g. en, zh-TW
+	Snapshot      string        // xml file or folder of snapshot for file source
+	CacheTTL      time.Duration // time to live of CWB dataset, 0 to refresh by issue time
+	Archiver      Archiver      // archive of downloaded CWB datasets, nil to disable
+	NowcastDataId string        // dataset id of CWB gridded nowcast, empty to use the default one
+	Clock         Clock         // source of "now", nil to use SystemClock
 }
 
+/**
+ * Weather of one period, it can be stored in json or bson directly
+ */
 type Weather struct {
-	weather      int
-	maxTemp      int
-	minTemp      int
-	comfortIndex int
-	pop          int
-}
-
-func transformWxToEnum(desc string) int {
-
-	wxMap := map[string]int{
-		"CLEAR":          WX_CLEAR,
-		"CLOUDY":         WX_CLOUDY,
-		"FOG":            WX_FOG,
-		"RAIN":           WX_RAIN,
-		"SHOWERS":        WX_SHOWERS,
-		"THUNDERSTORMS":  WX_THUNDERSTORMS,
-		"THUNDERSHOWERS": WX_THUNDERSHOWERS,
-		"LIGHT":          WX_LIGHTLY,
-		"PARTLY":         WX_PARTLY,
-		"MOSTLY":         WX_MOSTLY,
-		"OCCASIONAL":     WX_OCCASIONAL,
-		"LOCAL":          WX_LOCAL,
-		"AFTERNOON":      WX_AFTERNOON,
-	}
+	Wx           int     `json:"wx" bson:"wx"`                     // WX_ bitmap
+	MaxTemp      int     `json:"maxTemp" bson:"maxTemp"`           // celsius
+	MinTemp      int     `json:"minTemp" bson:"minTemp"`           // celsius
+	ComfortIndex int     `json:"comfortIndex" bson:"comfortIndex"` // CI_ bitmap
+	MinComfort   int     `json:"minComfort" bson:"minComfort"`
+	MaxComfort   int     `json:"maxComfort" bson:"maxComfort"`
+	Pop          int     `json:"pop" bson:"pop"`                                 // probability of precipitation in percent
+	Source       string  `json:"source" bson:"source"`                           // the meteorology source which answers
+	Temp         int     `json:"temp" bson:"temp"`                               // celsius, valid if TempKnown
+	ApparentTemp int     `json:"apparentTemp" bson:"apparentTemp"`               // celsius, valid if ApparentTempKnown
+	Humidity     int     `json:"humidity,omitempty" bson:"humidity,omitempty"`   // relative humidity in percent
+	WindSpeed    float64 `json:"windSpeed,omitempty" bson:"windSpeed,omitempty"` // m/s
+	UVIndex      int     `json:"uvIndex,omitempty" bson:"uvIndex,omitempty"`     // UV index, 0 if the source doesn't supply it
 
-	res := 0
+	// 0°C is a valid temperature, so presence is tracked apart from the value
+	TempKnown         bool `json:"tempKnown,omitempty" bson:"tempKnown,omitempty"`                 // the source supplies temperature
+	ApparentTempKnown bool `json:"apparentTempKnown,omitempty" bson:"apparentTempKnown,omitempty"` // supplied by the source or calculated
+}
 
-	for index, wx := range wxMap {
-		if strings.Contains(strings.ToUpper(desc), index) {
-			res += wx
-		}
-	}
+/**
+ * @name HasWx
+ * @brief Check if the weather has all the WX_ flags
+ * @param wx The WX_ flags e.g. WX_RAIN, WX_MOSTLY + WX_CLEAR
+ * @return bool True if all the flags are set
+ */
+func (weather *Weather) HasWx(wx int) bool {
+	return wx != 0 && weather.Wx&wx == wx
+}
+
+/**
+ * @name HasComfort
+ * @brief Check if the comfort index has any of the CI_ flags
+ * @param ci The CI_ flags e.g. CI_HOT + CI_VERY_HOT
+ * @return bool True if one of the flags is set
+ */
+func (weather *Weather) HasComfort(ci int) bool {
+	return weather.ComfortIndex&ci != 0
+}
+
+/**
+ * @name IsRainy
+ * @brief Check if any kind of precipitation is forecasted
+ * @return bool True if it rains, showers or thunderstorms
+ */
+func (weather *Weather) IsRainy() bool {
+	return weather.Wx&(WX_RAIN|WX_SHOWERS|WX_THUNDERSTORMS|WX_THUNDERSHOWERS) != 0
+}
+
+/**
+ * @name TempRange
+ * @brief Get the range of temperature of the weather
+ * @return int The minimum temperature in celsius
+ * @return int The maximum temperature in celsius
+ */
+func (weather *Weather) TempRange() (int, int) {
+	return weather.MinTemp, weather.MaxTemp
+}
 
-	return res
+/**
+ * @name ComfortRange
+ * @brief Get the range of comfort index number of the weather
+ * @return int The minimum comfort index
+ * @return int The maximum comfort index
+ */
+func (weather *Weather) ComfortRange() (int, int) {
+	return weather.MinComfort, weather.MaxComfort
+}
+
+/**
+ * Weather of one forecast period, the period is [StartTime, EndTime)
+ */
+type Forecast struct {
+	StartTime time.Time `json:"startTime" bson:"startTime"`
+	EndTime   time.Time `json:"endTime" bson:"endTime"`
+	Weather   Weather   `json:"weather" bson:"weather"`
+}
+
+/**
+ * @name Now
+ * @brief Get current time of the clock of meteorology in the time zone of Central Weather Bureau
+ * @return time.Time The current time
+ */
+func (meteo *Meteorology) Now() time.Time {
+	return meteo.clock.Now().In(CWB_TIME_ZONE)
 }
 
+/**
+ * @name GetWeather
+ * @brief Get current weather of the location, sources are tried in order
+ * @param location The location we care about
+ * @return *Weather The weather with the source which answers
+ * @return error The Error description, this will be nil if no error occurs
+ */
 func (meteo *Meteorology) GetWeather(location string) (*Weather, error) {
-	t := time.Now()
-	data, err := meteo.meteoHandler.getWeather(location, t)
+	return meteo.GetWeatherAt(location, meteo.Now())
+}
+
+/**
+ * @name GetWeatherAt
+ * @brief Get weather of the location at the time, sources are tried in order
+ * The period which starts at the time is used on the boundary of periods,
+ * and the nearest period is used if the time is out of the forecast a little.
+ * @param location The location we care about
+ * @param t The time we care about
+ * @return *Weather The weather with the source which answers
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *Meteorology) GetWeatherAt(location string, t time.Time) (*Weather, error) {
+	var data *Weather
+	source, err := meteo.fallThrough(func(handler meteorology) error {
+		var err error
+		data, err = handler.getWeather(location, t)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	data.Source = source
+	data.fillApparentTemp()
 	return data, nil
 }
 
+/**
+ * @name GetForecast
+ * @brief Get every forecast period of the location which overlaps [from, to)
+ * @param location The location we care about
+ * @param from The begin of the time range
+ * @param to The end of the time range
+ * @return []Forecast The forecast periods ordered by start time
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *Meteorology) GetForecast(location string, from time.Time, to time.Time) ([]Forecast, error) {
+	if !from.Before(to) {
+		return nil, errors.New("invalid forecast time range")
+	}
+	var data []Forecast
+	source, err := meteo.fallThrough(func(handler meteorology) error {
+		var err error
+		data, err = handler.getForecast(location, from, to)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for index := range data {
+		data[index].Weather.Source = source
+		data[index].Weather.fillApparentTemp()
+	}
+	return data, nil
+}
+
+/**
+ * @name GetTownshipForecast
+ * @brief Get every 3 hours forecast of the township which overlaps [from, to)
+ * The forecast of county is used if no source can answer the township.
+ * @param county The county e.g. 臺北市, Taipei City
+ * @param township The township e.g. 信義區
+ * @param from The begin of the time range
+ * @param to The end of the time range
+ * @return []Forecast The forecast periods ordered by start time
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *Meteorology) GetTownshipForecast(county string, township string, from time.Time, to time.Time) ([]Forecast, error) {
+	if !from.Before(to) {
+		return nil, errors.New("invalid forecast time range")
+	}
+	for _, provider := range meteo.providers {
+		handler, ok := provider.handler.(townshipMeteorology)
+		if !ok {
+			continue
+		}
+		data, err := handler.getTownshipForecast(county, township, from, to)
+		meteo.record(provider, err)
+		if err != nil {
+			continue
+		}
+		for index := range data {
+			data[index].Weather.Source = provider.source
+			data[index].Weather.fillApparentTemp()
+		}
+		return data, nil
+	}
+	return meteo.GetForecast(county, from, to)
+}
+
+/**
+ * @name GetWarnings
+ * @brief Get weather warnings of the county which are in effect now
+ * @param county The county e.g. 臺北市, Taipei City
+ * @return []Warning The active warnings, the most severe one is the first
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *Meteorology) GetWarnings(county string) ([]Warning, error) {
+	t := meteo.Now()
+	err := errNoWarningSource
+	for _, provider := range meteo.providers {
+		handler, ok := provider.handler.(warningMeteorology)
+		if !ok {
+			continue
+		}
+		var data []Warning
+		data, err = handler.getWarnings(county, t)
+		meteo.record(provider, err)
+		if err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+/**
+ * @name GetObservation
+ * @brief Get current observation of the station nearest to the location
+ * @param lat The latitude of location
+ * @param lng The longtitude of location
+ * @return *Observation The observation with distance and age of station
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *Meteorology) GetObservation(lat float64, lng float64) (*Observation, error) {
+	t := meteo.Now()
+	err := errNoObservationSource
+	for _, provider := range meteo.providers {
+		handler, ok := provider.handler.(observationMeteorology)
+		if !ok {
+			continue
+		}
+		var data *Observation
+		data, err = handler.getObservation(lat, lng, t)
+		meteo.record(provider, err)
+		if err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+/**
+ * @name GetNowcast
+ * @brief Get expected rainfall of the next 60 minutes in 10 minutes steps at the location
+ * @param lat The latitude of location
+ * @param lng The longtitude of location
+ * @return *Nowcast The nowcast of the nearest grid cell
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *Meteorology) GetNowcast(lat float64, lng float64) (*Nowcast, error) {
+	t := meteo.Now()
+	err := errNoNowcastSource
+	for _, provider := range meteo.providers {
+		handler, ok := provider.handler.(nowcastMeteorology)
+		if !ok {
+			continue
+		}
+		var data *Nowcast
+		data, err = handler.getNowcast(lat, lng, t)
+		meteo.record(provider, err)
+		if err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+/**
+ * @name GetSunTimes
+ * @brief Get sunrise, sunset and civil twilight of the location today, it works offline
+ * @param lat The latitude of location
+ * @param lng The longtitude of location
+ * @return *SunTimes The sun times in local time
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *Meteorology) GetSunTimes(lat float64, lng float64) (*SunTimes, error) {
+	return SunTimesOf(lat, lng, meteo.Now())
+}
+
+/**
+ * @name IsDark
+ * @brief Check if it is dark at the location now
+ * @param lat The latitude of location
+ * @param lng The longtitude of location
+ * @return bool True if the sun is below civil twilight
+ */
+func (meteo *Meteorology) IsDark(lat float64, lng float64) bool {
+	return IsDark(lat, lng, meteo.Now())
+}
+
 func NewMeteorology(apiKey string, language string, logFile io.Writer) *Meteorology {
 
 	meteo := Meteorology{
-		meteoHandler: newCwdMeteo(apiKey, language, logFile),
-		//meteoHandler: newOwmMeteo(apiKey, language, logFile),
+		providers: []*meteoProvider{
+			&meteoProvider{
+				source:  METEO_SOURCE_CWB,
+				handler: newCwdMeteo(apiKey, language, logFile),
+				health:  ProviderHealth{Source: METEO_SOURCE_CWB},
+			},
+		},
 		apiKey:   apiKey,
 		language: language,
+		clock:    SystemClock,
 	}
 
 	return &meteo
 }
+
+/**
+ * @name NewMeteorologyByConfig
+ * @brief Create a meteorology instance with the sources in configuration
+ * @param conf The configuration
+ * @param logFile The log writer, nil to disable logging
+ * @return *Meteorology The meteorology instance
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func NewMeteorologyByConfig(conf Config, logFile io.Writer) (*Meteorology, error) {
+
+	if conf.Clock == nil {
+		conf.Clock = SystemClock
+	}
+
+	sources := conf.Sources
+	if len(sources) == 0 {
+		sources = []string{conf.Source}
+	}
+
+	providers := []*meteoProvider{}
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			source = METEO_SOURCE_CWB
+		}
+		handler, err := newMeteoHandler(source, conf, logFile)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, &meteoProvider{
+			source:  source,
+			handler: handler,
+			health:  ProviderHealth{Source: source},
+		})
+	}
+
+	meteo := Meteorology{
+		providers: providers,
+		apiKey:    conf.ApiKey,
+		language:  conf.Language,
+		clock:     conf.Clock,
+	}
+
+	return &meteo, nil
+}
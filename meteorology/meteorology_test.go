@@ -5,11 +5,23 @@
 package meteorology
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/spf13/viper"
+	"gopkg.in/mgo.v2/bson"
 )
 
 type weatherTestCase struct {
@@ -48,12 +60,12 @@ func TestWeatherApi(t *testing.T) {
 			defer wg.Done()
 			meteo := NewMeteorology(cwdApiKey, "en", nil)
 			data, err := meteo.GetWeather(testCase.location)
-			if err != nil || data.weather != testCase.expect {
+			if err != nil || data.Wx != testCase.expect {
 				t.Error(
 					"#", index,
 					"location", testCase.location,
 					"Expected", testCase.expect,
-					"Got", data.weather,
+					"Got", data.Wx,
 					"Failed",
 				)
 			} else {
@@ -61,7 +73,7 @@ func TestWeatherApi(t *testing.T) {
 					"#", index,
 					"location", testCase.location,
 					"Expected", testCase.expect,
-					"Got", data.weather,
+					"Got", data.Wx,
 					"Pass",
 				)
 			}
@@ -69,3 +81,1567 @@ func TestWeatherApi(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+/**
+ * Load the dataset of a Central Weather Bureau xml file in testCase folder
+ */
+func loadTestDataset(t *testing.T, file string) dataset {
+
+	raw, err := ioutil.ReadFile("../testCase/" + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := Weathers{}
+	if err := xml.Unmarshal(raw, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v.DataSet
+}
+
+type forecastTestCase struct {
+	from    string
+	to      string
+	expects []int // maxTemp of each period
+}
+
+/**
+ * Test job for multi-period forecast of F-C0032-002.xml
+ */
+func TestForecastOfLocation(t *testing.T) {
+
+	meteo := newCwdMeteo("", "en", nil)
+	data := loadTestDataset(t, "F-C0032-002.xml")
+
+	location, err := meteo.dataOfLocation(data, "Taipei City")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []forecastTestCase{
+		forecastTestCase{from: "2016-09-09T18:00:00+08:00", to: "2016-09-11T06:00:00+08:00", expects: []int{28, 32, 29}},
+		forecastTestCase{from: "2016-09-10T12:00:00+08:00", to: "2016-09-10T20:00:00+08:00", expects: []int{32, 29}},
+		forecastTestCase{from: "2016-09-09T10:00:00Z", to: "2016-09-09T11:00:00Z", expects: []int{28}},
+		forecastTestCase{from: "2016-09-12T00:00:00+08:00", to: "2016-09-13T00:00:00+08:00", expects: nil},
+	}
+
+	for index, testCase := range testCases {
+		from, _ := time.Parse(time.RFC3339, testCase.from)
+		to, _ := time.Parse(time.RFC3339, testCase.to)
+
+		forecasts, err := meteo.forecastOfLocation(*location, from, to)
+		if testCase.expects == nil {
+			if err == nil {
+				t.Error("#", index, "Expected error", "Got", forecasts, "Failed")
+			}
+			continue
+		}
+		if err != nil || len(forecasts) != len(testCase.expects) {
+			t.Error("#", index, "Expected", testCase.expects, "Got", forecasts, err, "Failed")
+			continue
+		}
+		for i, forecast := range forecasts {
+			if forecast.Weather.MaxTemp != testCase.expects[i] {
+				t.Error("#", index, "period", i, "Expected", testCase.expects[i], "Got", forecast.Weather.MaxTemp, "Failed")
+			}
+			if i > 0 && !forecasts[i-1].EndTime.Equal(forecast.StartTime) {
+				t.Error("#", index, "period", i, "is not ordered", "Failed")
+			}
+		}
+	}
+
+	first, err := meteo.forecastOfLocation(*location, time.Date(2016, 9, 9, 20, 0, 0, 0, time.UTC), time.Date(2016, 9, 9, 21, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Weather{Wx: WX_MOSTLY + WX_CLOUDY + WX_SHOWERS + WX_THUNDERSTORMS, MaxTemp: 28, MinTemp: 25, ComfortIndex: CI_COMFORTABLE + CI_HOT, MinComfort: 20, MaxComfort: 30, Pop: 70}
+	if first[0].Weather != expect {
+		t.Error("Expected", expect, "Got", first[0].Weather, "Failed")
+	}
+}
+
+type wxTestCase struct {
+	desc   string
+	code   int
+	expect int
+}
+
+/**
+ * Test job for weather description decoder in both languages
+ */
+func TestDecodeWx(t *testing.T) {
+
+	testCases := []wxTestCase{
+		wxTestCase{desc: "MOSTLY CLEAR", expect: WX_MOSTLY + WX_CLEAR},
+		wxTestCase{desc: "PARTLY CLOUDY WITH OCCASIONAL SHOWERS OR THUNDERSHOWERS", expect: WX_PARTLY + WX_CLOUDY + WX_OCCASIONAL + WX_SHOWERS + WX_THUNDERSHOWERS},
+		wxTestCase{desc: "light rain", expect: WX_LIGHTLY + WX_RAIN},
+		wxTestCase{desc: "overcast clouds", expect: WX_CLOUDY},
+		wxTestCase{desc: "晴時多雲", expect: WX_MOSTLY + WX_CLEAR},
+		wxTestCase{desc: "多雲時晴", expect: WX_PARTLY + WX_CLEAR},
+		wxTestCase{desc: "多雲", expect: WX_PARTLY + WX_CLOUDY},
+		wxTestCase{desc: "陰時多雲", expect: WX_MOSTLY + WX_CLOUDY},
+		wxTestCase{desc: "陰天", expect: WX_CLOUDY},
+		wxTestCase{desc: "多雲短暫陣雨", expect: WX_PARTLY + WX_CLOUDY + WX_OCCASIONAL + WX_SHOWERS},
+		wxTestCase{desc: "多雲時陰短暫陣雨", expect: WX_MOSTLY + WX_CLOUDY + WX_OCCASIONAL + WX_SHOWERS},
+		wxTestCase{desc: "多雲午後短暫雷陣雨", expect: WX_PARTLY + WX_CLOUDY + WX_AFTERNOON + WX_OCCASIONAL + WX_THUNDERSHOWERS},
+		wxTestCase{desc: "陰局部短暫陣雨或雷雨", expect: WX_CLOUDY + WX_LOCAL + WX_OCCASIONAL + WX_SHOWERS + WX_THUNDERSTORMS},
+		wxTestCase{desc: "晴有霧", expect: WX_CLEAR + WX_FOG},
+		wxTestCase{desc: "", code: 8, expect: WX_MOSTLY + WX_CLEAR},
+		wxTestCase{desc: "unknown", code: 12, expect: WX_PARTLY + WX_CLOUDY + WX_OCCASIONAL + WX_SHOWERS},
+		wxTestCase{desc: "unknown", code: 99, expect: 0},
+	}
+
+	for index, testCase := range testCases {
+		if res := decodeWx(testCase.desc, testCase.code); res != testCase.expect {
+			t.Error("#", index, "desc", testCase.desc, "Expected", testCase.expect, "Got", res, "Failed")
+		}
+	}
+
+	// a code which is not in the fixtures is reported instead of being 0 silently
+	if res := decodeWx("", 3); res != 0 {
+		t.Error("Expected 0 for unknown code", "Got", res, "Failed")
+	}
+	unknownWxCodes.mutex.Lock()
+	_, reported := unknownWxCodes.codes[3]
+	_, known := unknownWxCodes.codes[8]
+	unknownWxCodes.mutex.Unlock()
+	if !reported || known {
+		t.Error("Expected only code 3 reported", "Got", unknownWxCodes.codes, "Failed")
+	}
+
+	// every Wx description in the fixtures must be decoded
+	for _, file := range []string{"F-C0032-001.xml", "F-C0032-002.xml"} {
+		data := loadTestDataset(t, file)
+		for _, location := range data.Locations {
+			for _, element := range location.WeatherElements {
+				if element.ElementName != "Wx" {
+					continue
+				}
+				for _, dataOfTime := range element.Time {
+					if transformWxToEnum(dataOfTime.Parameter.Name)|transformChineseWxToEnum(dataOfTime.Parameter.Name) == 0 {
+						t.Error(file, location.LocationName, "can not decode", dataOfTime.Parameter.Name, "Failed")
+					}
+				}
+			}
+		}
+	}
+
+	// the same forecast of zh-TW dataset must be decoded as well as en dataset
+	meteo := newCwdMeteo("", "zh-TW", nil)
+	location, err := meteo.dataOfLocation(loadTestDataset(t, "F-C0032-001.xml"), "臺北市")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forecasts, err := meteo.forecastOfLocation(*location, time.Date(2016, 8, 27, 0, 0, 0, 0, time.UTC), time.Date(2016, 8, 28, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []int{
+		WX_PARTLY + WX_CLOUDY + WX_OCCASIONAL + WX_SHOWERS,
+		WX_MOSTLY + WX_CLOUDY + WX_OCCASIONAL + WX_SHOWERS,
+		WX_PARTLY + WX_CLOUDY + WX_OCCASIONAL + WX_SHOWERS,
+	}
+	if len(forecasts) != len(expects) {
+		t.Fatal("Expected", len(expects), "periods", "Got", len(forecasts), "Failed")
+	}
+	for i, forecast := range forecasts {
+		if forecast.Weather.Wx != expects[i] {
+			t.Error("period", i, "Expected", expects[i], "Got", forecast.Weather.Wx, "Failed")
+		}
+	}
+}
+
+type ciTestCase struct {
+	desc    string
+	expect  int
+	minimum int
+	maximum int
+}
+
+/**
+ * Test job for comfort index parser in both languages
+ */
+func TestComfortIndex(t *testing.T) {
+
+	testCases := []ciTestCase{
+		ciTestCase{desc: "COMFORTABLE", expect: CI_COMFORTABLE, minimum: 20, maximum: 26},
+		ciTestCase{desc: "COMFORTABLE~HOT", expect: CI_COMFORTABLE + CI_HOT, minimum: 20, maximum: 30},
+		ciTestCase{desc: "舒適至悶熱", expect: CI_COMFORTABLE + CI_HOT, minimum: 20, maximum: 30},
+		ciTestCase{desc: "舒適至易中暑", expect: CI_COMFORTABLE + CI_HOT + CI_VERY_HOT, minimum: 20, maximum: CI_VALUE_HIGHEST},
+		ciTestCase{desc: "悶熱至易中暑", expect: CI_HOT + CI_VERY_HOT, minimum: 27, maximum: CI_VALUE_HIGHEST},
+		ciTestCase{desc: "寒冷至稍有寒意", expect: CI_COLD + CI_CHILLY, minimum: 11, maximum: 19},
+		ciTestCase{desc: "非常寒冷", expect: CI_VERY_COLD, minimum: CI_VALUE_LOWEST, maximum: 10},
+		ciTestCase{desc: "slightly cold~comfortable", expect: CI_CHILLY + CI_COMFORTABLE, minimum: 16, maximum: 26},
+		ciTestCase{desc: "24", expect: CI_COMFORTABLE, minimum: 24, maximum: 24},
+		ciTestCase{desc: "unknown", expect: 0, minimum: 0, maximum: 0},
+	}
+
+	for index, testCase := range testCases {
+		res, minimum, maximum := transformCIToEnum(testCase.desc)
+		if res != testCase.expect || minimum != testCase.minimum || maximum != testCase.maximum {
+			t.Error(
+				"#", index,
+				"desc", testCase.desc,
+				"Expected", testCase.expect, testCase.minimum, testCase.maximum,
+				"Got", res, minimum, maximum,
+				"Failed",
+			)
+		}
+	}
+}
+
+type fileTestCase struct {
+	snapshot string
+	language string
+	location string
+	expect   int // maxTemp of the first period
+}
+
+/**
+ * Test job for file snapshot source, this runs without network
+ */
+func TestFileMeteo(t *testing.T) {
+
+	testCases := []fileTestCase{
+		fileTestCase{snapshot: "../testCase", language: "en", location: "Taipei City", expect: 28},
+		fileTestCase{snapshot: "../testCase", language: "zh-TW", location: "臺北市", expect: 34},
+		fileTestCase{snapshot: "../testCase/F-C0032-002.xml", language: "en", location: "Keelung City", expect: 27},
+	}
+
+	for index, testCase := range testCases {
+		meteo, err := NewMeteorologyByConfig(Config{Source: METEO_SOURCE_FILE, Language: testCase.language, Snapshot: testCase.snapshot}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := meteo.GetWeather(testCase.location)
+		if err != nil || data.MaxTemp != testCase.expect {
+			t.Error("#", index, "location", testCase.location, "Expected", testCase.expect, "Got", data, err, "Failed")
+		}
+	}
+
+	meteo, _ := NewMeteorologyByConfig(Config{Source: METEO_SOURCE_FILE, Language: "en", Snapshot: "../testCase"}, nil)
+	now := time.Now()
+	forecasts, err := meteo.GetForecast("Taipei City", now, now.Add(24*time.Hour))
+	if err != nil || len(forecasts) != 2 {
+		t.Error("Expected 2 periods", "Got", forecasts, err, "Failed")
+	}
+
+	if _, err := NewMeteorologyByConfig(Config{Source: "unknown"}, nil); err == nil {
+		t.Error("Expected error for unknown source", "Failed")
+	}
+}
+
+/**
+ * Stand-in openWeatherMap server which responds the json in testCase folder
+ */
+func newOwmTestServer(t *testing.T) *httptest.Server {
+
+	files := map[string]string{
+		"/weather":  "../testCase/openWeatherMapTaipeiWeather.json",
+		"/forecast": "../testCase/openWeatherMapTaipeiForecast.json",
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/uvi" {
+			if r.URL.Query().Get("lat") != "25.02" || r.URL.Query().Get("lon") != "121.54" {
+				rw.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(rw, `{"cod":"400","message":"wrong coordinate"}`)
+				return
+			}
+			fmt.Fprint(rw, `{"lat":25.02,"lon":121.54,"date_iso":"2016-10-10T12:00:00Z","date":1476100800,"value":7.12}`)
+			return
+		}
+		file, ok := files[r.URL.Path]
+		if !ok || r.URL.Query().Get("q") != "Taipei,TW" || r.URL.Query().Get("APPID") != "key" {
+			rw.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(rw, `{"cod":"404","message":"city not found"}`)
+			return
+		}
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Error(err)
+		}
+		rw.Write(raw)
+	}))
+}
+
+/**
+ * Test job for openWeatherMap source with stand-in server
+ */
+func TestOwmMeteo(t *testing.T) {
+
+	server := newOwmTestServer(t)
+	defer server.Close()
+
+	meteo := newOwmMeteo("key", "en", server.URL, nil)
+
+	// the first item of forecast fixture starts at 1476090000
+	now := time.Unix(1476090000, 0)
+	meteo.clock = NewFixedClock(now)
+	data, err := meteo.getWeather("Taipei City", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Weather{Wx: WX_LIGHTLY + WX_RAIN, MaxTemp: 26, MinTemp: 26, ComfortIndex: CI_COMFORTABLE, MinComfort: 26, MaxComfort: 26, Pop: 100,
+		Temp: 26, TempKnown: true, Humidity: 96, WindSpeed: 4.21, UVIndex: 7}
+	if *data != expect {
+		t.Error("Expected", expect, "Got", *data, "Failed")
+	}
+
+	forecasts, err := meteo.getForecast("Taipei City", now, now.Add(9*time.Hour))
+	if err != nil || len(forecasts) != 3 {
+		t.Error("Expected 3 periods", "Got", forecasts, err, "Failed")
+	}
+
+	if _, err := meteo.getWeather("Atlantis", now); err == nil {
+		t.Error("Expected error for unknown city", "Failed")
+	}
+
+	// tomorrow is the slot of forecast starts at 2016-10-11 09:00 UTC, not current weather
+	data, err = meteo.getWeather("Taipei City", now.Add(24*time.Hour))
+	expect = Weather{Wx: WX_LIGHTLY + WX_RAIN, MaxTemp: 25, MinTemp: 25, ComfortIndex: CI_COMFORTABLE, MinComfort: 25, MaxComfort: 25, Pop: 100,
+		Temp: 25, TempKnown: true, Humidity: 100, WindSpeed: 10.06}
+	if err != nil || *data != expect {
+		t.Error("Expected", expect, "Got", data, err, "Failed")
+	}
+	// the slot before the first one is the nearest
+	if data, err := meteo.getWeather("Taipei City", now.Add(-4*time.Hour)); err != nil || data.WindSpeed != 8.31 {
+		t.Error("Expected the first slot", "Got", data, err, "Failed")
+	}
+	if data, err := meteo.getWeather("Taipei City", now.Add(10*24*time.Hour)); err == nil {
+		t.Error("Expected error out of forecast", "Got", data, "Failed")
+	}
+
+	selected, err := NewMeteorologyByConfig(Config{Source: METEO_SOURCE_OWM, OwmApiKey: "key", OwmUrl: server.URL, Language: "en"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weather, err := selected.GetWeather("Taipei City")
+	if err != nil {
+		t.Fatal("Expected weather from owm source", "Got", err, "Failed")
+	}
+	// apparent temperature is calculated from temperature, humidity and wind
+	if weather.ApparentTemp != 30 {
+		t.Error("Expected apparent temperature 30", "Got", weather.ApparentTemp, "Failed")
+	}
+}
+
+type apparentTempTestCase struct {
+	temp     float64
+	humidity float64
+	wind     float64
+	expect   float64
+}
+
+func TestApparentTemperature(t *testing.T) {
+
+	testCases := []apparentTempTestCase{
+		// worked out by hand, e.g. 30°C 50%: e = 0.5 * 6.105 * exp(17.27 * 30 / 267.7) = 21.14
+		{30, 50, 0, 33.0},
+		{30, 80, 0, 37.2},
+		{20, 60, 3, 18.5},
+		{35, 70, 1, 43.2},
+	}
+
+	for index, testCase := range testCases {
+		res := ApparentTemperature(testCase.temp, testCase.humidity, testCase.wind)
+		if math.Abs(res-testCase.expect) > 0.2 {
+			t.Error("#", index, "Expected", testCase.expect, "Got", res, "Failed")
+		}
+	}
+
+	weather := Weather{MinTemp: 28, MaxTemp: 32, Humidity: 80}
+	weather.fillApparentTemp()
+	if weather.ApparentTemp != 37 {
+		t.Error("Expected 37 from middle of temperature range", "Got", weather.ApparentTemp, "Failed")
+	}
+	weather = Weather{Temp: 30, TempKnown: true, ApparentTemp: 33, ApparentTempKnown: true, Humidity: 80}
+	weather.fillApparentTemp()
+	if weather.ApparentTemp != 33 {
+		t.Error("Expected apparent temperature of source is kept", "Got", weather.ApparentTemp, "Failed")
+	}
+	weather = Weather{Temp: 30, TempKnown: true}
+	weather.fillApparentTemp()
+	if weather.ApparentTemp != 0 || weather.ApparentTempKnown {
+		t.Error("Expected no apparent temperature without humidity", "Got", weather.ApparentTemp, "Failed")
+	}
+	// 0°C is a temperature, not the middle of -2 and 4
+	weather = Weather{MinTemp: -2, MaxTemp: 4, Temp: 0, TempKnown: true, Humidity: 80}
+	weather.fillApparentTemp()
+	if weather.ApparentTemp != -2 || !weather.ApparentTempKnown {
+		t.Error("Expected -2 from 0°C", "Got", weather.ApparentTemp, "Failed")
+	}
+	// apparent temperature of 0°C from the source is kept
+	weather = Weather{MinTemp: 3, MaxTemp: 3, Temp: 3, TempKnown: true, ApparentTemp: 0, ApparentTempKnown: true, Humidity: 80}
+	weather.fillApparentTemp()
+	if weather.ApparentTemp != 0 || !strings.Contains(weather.Summary("en"), "feels like 0°C") {
+		t.Error("Expected feels like 0°C", "Got", weather.ApparentTemp, weather.Summary("en"), "Failed")
+	}
+
+	// negative temperatures are rounded the same way as positive ones
+	for temp, expect := range map[float64]int{-1.6: -2, -1.4: -1, -0.4: 0, 0.5: 1, 25.25: 25} {
+		if res := roundCelsius(temp); res != expect {
+			t.Error("Round", temp, "Expected", expect, "Got", res, "Failed")
+		}
+	}
+
+	for uvi, level := range map[int]string{0: "low", 3: "moderate", 7: "high", 10: "very high", 11: "extreme"} {
+		if res := (&Weather{UVIndex: uvi}).UVLevel("en"); res != level {
+			t.Error("UV index", uvi, "Expected", level, "Got", res, "Failed")
+		}
+	}
+}
+
+/**
+ * Test job for falling through meteorology sources
+ */
+func TestFallback(t *testing.T) {
+
+	clock := NewFixedClock(time.Now())
+	conf := Config{
+		Sources:  []string{METEO_SOURCE_OWM, METEO_SOURCE_FILE},
+		Language: "en",
+		Snapshot: "../testCase",
+		Clock:    clock,
+	}
+	meteo, err := NewMeteorologyByConfig(conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// owm fails without api key, file answers
+	data, err := meteo.GetWeather("Taipei City")
+	if err != nil || data.Source != METEO_SOURCE_FILE {
+		t.Error("Expected source", METEO_SOURCE_FILE, "Got", data, err, "Failed")
+	}
+
+	// no source knows the location
+	if _, err := meteo.GetWeather("Atlantis"); err == nil {
+		t.Error("Expected error for unknown location", "Failed")
+	}
+
+	now := time.Now()
+	forecasts, err := meteo.GetForecast("Taipei City", now, now.Add(3*time.Hour))
+	if err != nil || forecasts[0].Weather.Source != METEO_SOURCE_FILE {
+		t.Error("Expected forecast from", METEO_SOURCE_FILE, "Got", forecasts, err, "Failed")
+	}
+
+	expects := []ProviderHealth{
+		ProviderHealth{Source: METEO_SOURCE_OWM, Success: 0, Failure: 3},
+		ProviderHealth{Source: METEO_SOURCE_FILE, Success: 2, Failure: 1},
+	}
+	for index, health := range meteo.Health() {
+		if health.Source != expects[index].Source || health.Success != expects[index].Success || health.Failure != expects[index].Failure {
+			t.Error("#", index, "Expected", expects[index], "Got", health, "Failed")
+		}
+		// failures are stamped by the clock of meteorology
+		if !health.LastFailure.Equal(clock.Now()) {
+			t.Error("#", index, "Expected last failure at", clock.Now(), "Got", health.LastFailure, "Failed")
+		}
+	}
+	if owm := meteo.providers[0].handler.(*owmMeteo); owm.clock != clock {
+		t.Error("Expected the clock of configuration in openWeatherMap", "Failed")
+	}
+
+	if _, err := NewMeteorologyByConfig(Config{Sources: []string{METEO_SOURCE_CWB, "unknown"}}, nil); err == nil {
+		t.Error("Expected error for unknown source", "Failed")
+	}
+}
+
+/**
+ * Test job for dataset cache, concurrent callers should share one fetch
+ */
+func TestDatasetCache(t *testing.T) {
+
+	cache := newDatasetCache()
+
+	var mutex sync.Mutex
+	fetchCount := 0
+	issueTime := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	fetch := func() (interface{}, *datasetInfo, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		fetchCount++
+		v := Weathers{}
+		v.DataSet.DatasetInfo.IssueTime = issueTime
+		return &v, &v.DataSet.DatasetInfo, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(20)
+	for i := 0; i < 20; i++ {
+		go func() {
+			defer wg.Done()
+			if _, err := cache.get("F-C0032-002", 0, fetch); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if fetchCount != 1 {
+		t.Error("Expected 1 fetch", "Got", fetchCount, "Failed")
+	}
+
+	// refreshed by ttl
+	cache.get("F-C0032-001", time.Millisecond, fetch)
+	time.Sleep(5 * time.Millisecond)
+	cache.get("F-C0032-001", time.Millisecond, fetch)
+	if fetchCount != 3 {
+		t.Error("Expected 3 fetches", "Got", fetchCount, "Failed")
+	}
+
+	// the ttl of each caller applies, not the ttl of the caller which fetched first
+	cache.get("F-D0047-061", time.Hour, fetch)
+	time.Sleep(5 * time.Millisecond)
+	cache.get("F-D0047-061", time.Millisecond, fetch)
+	cache.get("F-D0047-061", time.Hour, fetch)
+	if fetchCount != 5 {
+		t.Error("Expected 5 fetches", "Got", fetchCount, "Failed")
+	}
+
+	// an outdated dataset is retried later instead of every lookup
+	issueTime = "2016-09-09T17:00:00+08:00"
+	cache.clear()
+	cache.get("F-C0032-002", 0, fetch)
+	cache.get("F-C0032-002", 0, fetch)
+	if fetchCount != 6 {
+		t.Error("Expected 6 fetches", "Got", fetchCount, "Failed")
+	}
+
+	now := time.Now()
+	info := datasetInfo{IssueTime: now.Add(-time.Hour).Format(time.RFC3339)}
+	if expireAt := cache.expireTime(&info, now); expireAt.Sub(now) < 4*time.Hour {
+		t.Error("Expected refresh after next issue", "Got", expireAt, "Failed")
+	}
+}
+
+/**
+ * Test job for weather serialization and accessors
+ */
+func TestWeatherSerialization(t *testing.T) {
+
+	weather := Weather{Wx: WX_PARTLY + WX_CLOUDY + WX_SHOWERS, MaxTemp: 33, MinTemp: 27, ComfortIndex: CI_COMFORTABLE + CI_HOT, MinComfort: 20, MaxComfort: 30, Pop: 20, Source: METEO_SOURCE_CWB}
+
+	raw, err := json.Marshal(weather)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJson := Weather{}
+	if err := json.Unmarshal(raw, &fromJson); err != nil || fromJson != weather {
+		t.Error("json Expected", weather, "Got", fromJson, err, "Failed")
+	}
+
+	raw, err = bson.Marshal(weather)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromBson := Weather{}
+	if err := bson.Unmarshal(raw, &fromBson); err != nil || fromBson != weather {
+		t.Error("bson Expected", weather, "Got", fromBson, err, "Failed")
+	}
+
+	if !weather.HasWx(WX_PARTLY+WX_CLOUDY) || weather.HasWx(WX_CLEAR) || !weather.IsRainy() {
+		t.Error("Wrong Wx accessors of", weather, "Failed")
+	}
+	if !weather.HasComfort(CI_HOT+CI_VERY_HOT) || weather.HasComfort(CI_COLD) {
+		t.Error("Wrong comfort accessors of", weather, "Failed")
+	}
+	if minimum, maximum := weather.TempRange(); minimum != 27 || maximum != 33 {
+		t.Error("Wrong temperature range of", weather, "Failed")
+	}
+}
+
+/**
+ * Test job for township forecast of F-D0047-061.xml
+ */
+func TestTownshipForecast(t *testing.T) {
+
+	raw, err := ioutil.ReadFile("../testCase/F-D0047-061.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := townshipWeathers{}
+	if err := xml.Unmarshal(raw, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	// prime the shared cache, so no request is sent to CWB
+	sharedDatasetCache.get("F-D0047-061", time.Hour, func() (interface{}, *datasetInfo, error) {
+		return &data, &data.DataSet.DatasetInfo, nil
+	})
+	defer sharedDatasetCache.clear()
+
+	meteo := newCwdMeteo("", "zh-TW", nil)
+	from, _ := time.Parse(time.RFC3339, "2016-09-09T18:00:00+08:00")
+
+	forecasts, err := meteo.getTownshipForecast("台北市", "信義區", from, from.Add(12*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forecasts) != 4 {
+		t.Fatal("Expected 4 periods", "Got", len(forecasts), "Failed")
+	}
+
+	expect := Weather{Wx: WX_PARTLY + WX_CLOUDY, MaxTemp: 29, MinTemp: 29, Pop: 20, Temp: 29, TempKnown: true, ApparentTemp: 33, ApparentTempKnown: true, Humidity: 75, WindSpeed: 2}
+	if forecasts[0].Weather != expect {
+		t.Error("Expected", expect, "Got", forecasts[0].Weather, "Failed")
+	}
+	expect = Weather{Wx: WX_CLOUDY + WX_OCCASIONAL + WX_RAIN, MaxTemp: 28, MinTemp: 28, Pop: 30, Temp: 28, TempKnown: true, ApparentTemp: 31, ApparentTempKnown: true, Humidity: 82, WindSpeed: 1}
+	if forecasts[3].Weather != expect || !forecasts[3].StartTime.Equal(from.Add(9*time.Hour)) {
+		t.Error("Expected", expect, "Got", forecasts[3], "Failed")
+	}
+
+	// UV index is given for the daytime
+	forecasts, err = meteo.getTownshipForecast("台北市", "信義區", from.Add(12*time.Hour), from.Add(15*time.Hour))
+	if err != nil || len(forecasts) != 1 {
+		t.Fatal("Expected 1 period", "Got", forecasts, err, "Failed")
+	}
+	if forecasts[0].Weather.UVIndex != 9 || forecasts[0].Weather.UVLevel("zh-TW") != "過量級" || forecasts[0].Weather.WindSpeed != 3 {
+		t.Error("Expected UV index 9 and wind 3 m/s", "Got", forecasts[0].Weather, "Failed")
+	}
+
+	if _, err := meteo.getTownshipForecast("Taipei City", "Atlantis", from, from.Add(time.Hour)); err == nil {
+		t.Error("Expected error for unknown township", "Failed")
+	}
+
+	// file source has no township forecast, the county forecast is used
+	fileMeteo, _ := NewMeteorologyByConfig(Config{Source: METEO_SOURCE_FILE, Language: "en", Snapshot: "../testCase"}, nil)
+	now := time.Now()
+	forecasts, err = fileMeteo.GetTownshipForecast("Taipei City", "Xinyi District", now, now.Add(3*time.Hour))
+	if err != nil || len(forecasts) != 1 || forecasts[0].Weather.MaxTemp != 28 {
+		t.Error("Expected county forecast", "Got", forecasts, err, "Failed")
+	}
+}
+
+type warningTestCase struct {
+	county    string
+	time      string
+	kinds     []string
+	severity  int
+	isTyphoon bool
+}
+
+func TestWarnings(t *testing.T) {
+
+	raw, err := ioutil.ReadFile("../testCase/W-C0033-001.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := warningWeathers{}
+	if err := xml.Unmarshal(raw, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	meteo := newCwdMeteo("", "zh-TW", nil)
+
+	testCases := []warningTestCase{
+		{"臺北市", "2016-09-27T12:00:00+08:00", []string{WARN_TYPHOON, WARN_HEAVY_RAIN}, WARN_SEVERITY_EXTREME, true},
+		{"Taipei City", "2016-09-28T10:00:00+08:00", []string{WARN_TYPHOON}, WARN_SEVERITY_EXTREME, true},
+		{"台北市", "2016-09-28T20:30:00+08:00", []string{}, 0, false},
+		{"New Taipei City", "2016-09-27T08:00:00+08:00", []string{WARN_HEAVY_RAIN}, WARN_SEVERITY_MODERATE, false},
+		{"臺東縣", "2016-09-25T12:00:00+08:00", []string{WARN_HEAT}, WARN_SEVERITY_MINOR, false},
+		{"澎湖縣", "2016-09-27T12:00:00+08:00", []string{}, 0, false},
+	}
+
+	for index, testCase := range testCases {
+		at, _ := time.Parse(time.RFC3339, testCase.time)
+		warnings, err := meteo.warningsOfCounty(&data, testCase.county, at)
+		if err != nil {
+			t.Error("#", index, "Expected no error", "Got", err, "Failed")
+			continue
+		}
+		if len(warnings) != len(testCase.kinds) {
+			t.Error("#", index, "Expected", testCase.kinds, "Got", warnings, "Failed")
+			continue
+		}
+		for i, kind := range testCase.kinds {
+			if warnings[i].Kind != kind {
+				t.Error("#", index, "Expected", kind, "Got", warnings[i].Kind, "Failed")
+			}
+		}
+		if len(warnings) > 0 && warnings[0].Severity != testCase.severity {
+			t.Error("#", index, "Expected severity", testCase.severity, "Got", warnings[0].Severity, "Failed")
+		}
+		if HasWarning(warnings, WARN_TYPHOON) != testCase.isTyphoon {
+			t.Error("#", index, "Expected typhoon", testCase.isTyphoon, "Failed")
+		}
+	}
+
+	if _, err := meteo.warningsOfCounty(&data, "Atlantis", time.Now()); err == nil {
+		t.Error("Expected error for unknown county", "Failed")
+	}
+}
+
+type observationTestCase struct {
+	lat         float64
+	lng         float64
+	stationId   string
+	temp        float64
+	humidity    int
+	rain        float64
+	rainStation string
+	maxDistance float64
+}
+
+func TestObservation(t *testing.T) {
+
+	loadObservation := func(path string) *observationWeathers {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := observationWeathers{}
+		if err := xml.Unmarshal(raw, &data); err != nil {
+			t.Fatal(err)
+		}
+		return &data
+	}
+	data := loadObservation("../testCase/O-A0001-001.xml")
+	rain := loadObservation("../testCase/O-A0002-001.xml")
+
+	now, _ := time.Parse(time.RFC3339, "2016-09-09T17:20:00+08:00")
+
+	testCases := []observationTestCase{
+		// Taipei 101
+		{25.0340, 121.5645, "C0AC70", 30.8, 66, 0, "信義", 500},
+		// National Taiwan University, the nearest rain gauge is not the nearest station
+		{25.0173, 121.5397, "C0AH70", 30.1, 71, 4.5, "公館", 1500},
+		// Shezi station fails to measure, so it is skipped
+		{25.1090, 121.4700, "C0AH70", 30.1, 71, 4.5, "公館", 12000},
+		// Songshan station reports -98 which is missing, not -98°C
+		{25.0485, 121.5500, "C0AC70", 30.8, 66, 0, "信義", 2500},
+	}
+
+	for index, testCase := range testCases {
+		obs, err := observationOfLatlng(data, rain, testCase.lat, testCase.lng, now)
+		if err != nil {
+			t.Error("#", index, "Expected no error", "Got", err, "Failed")
+			continue
+		}
+		if obs.StationId != testCase.stationId || obs.Temp != testCase.temp || obs.Humidity != testCase.humidity {
+			t.Error("#", index, "Expected", testCase, "Got", obs, "Failed")
+		}
+		if obs.Rain != testCase.rain || obs.RainStation != testCase.rainStation {
+			t.Error("#", index, "Expected rain", testCase.rain, "at", testCase.rainStation, "Got", obs.Rain, "at", obs.RainStation, "Failed")
+		}
+		if obs.Distance <= 0 || obs.Distance > testCase.maxDistance {
+			t.Error("#", index, "Expected distance under", testCase.maxDistance, "Got", obs.Distance, "Failed")
+		}
+		if obs.Age != now.Sub(obs.ObsTime) || obs.Age < 20*time.Minute {
+			t.Error("#", index, "Expected age of", obs.ObsTime, "Got", obs.Age, "Failed")
+		}
+	}
+
+	// rainfall is optional
+	obs, err := observationOfLatlng(data, nil, 25.0340, 121.5645, now)
+	if err != nil || obs.RainStation != "" || obs.IsRaining() {
+		t.Error("Expected observation without rain", "Got", obs, err, "Failed")
+	}
+
+	if _, err := observationOfLatlng(&observationWeathers{}, rain, 25.0340, 121.5645, now); err == nil {
+		t.Error("Expected error for empty dataset", "Failed")
+	}
+
+	// apparent temperature needs every input
+	if !obs.TempKnown || !obs.HumidityKnown || !obs.WindSpeedKnown || !obs.ApparentTempKnown || obs.ApparentTemp == 0 {
+		t.Error("Expected apparent temperature", "Got", obs, "Failed")
+	}
+	for index, element := range []string{"HUMD", "WDSD"} {
+		station := data.Stations[0]
+		station.WeatherElements = append([]observationElement{}, station.WeatherElements...)
+		for i := range station.WeatherElements {
+			if station.WeatherElements[i].ElementName == element {
+				station.WeatherElements[i].Value = "-99"
+			}
+		}
+		obs, err := observationOfLatlng(&observationWeathers{Stations: []observationStation{station}}, nil, 25.0340, 121.5645, now)
+		if err != nil || !obs.TempKnown || obs.ApparentTempKnown || obs.ApparentTemp != 0 {
+			t.Error("#", index, "Expected no apparent temperature without", element, "Got", obs, err, "Failed")
+		}
+	}
+}
+
+type countyTestCase struct {
+	name   string
+	expect string
+}
+
+func TestCountyMatcher(t *testing.T) {
+
+	testCases := []countyTestCase{
+		{"臺北市", "臺北市"},
+		{"台北市", "臺北市"},
+		{"Taipei City", "臺北市"},
+		{"TAIPEI CITY", "臺北市"},
+		{"taipei", "臺北市"},
+		{" New  Taipei City ", "新北市"},
+		{"臺北縣", "新北市"},
+		{"台中市", "臺中市"},
+		{"桃园市", "桃園市"},
+		{"台东县", "臺東縣"},
+		{"云林县", "雲林縣"},
+		{"Hsinchu County", "新竹縣"},
+		{"Hsinchu", "新竹市"},
+		{"嘉义县", "嘉義縣"},
+		{"Matsu", "連江縣"},
+		{"Atlantis", ""},
+		{"", ""},
+	}
+
+	for index, testCase := range testCases {
+		c, err := findCounty(testCase.name)
+		if testCase.expect == "" {
+			if err == nil {
+				t.Error("#", index, testCase.name, "Expected error", "Got", c.zh, "Failed")
+			}
+			continue
+		}
+		if err != nil || c.zh != testCase.expect {
+			t.Error("#", index, testCase.name, "Expected", testCase.expect, "Got", c, err, "Failed")
+		}
+		if name, err := CountyName(testCase.name, "zh-TW"); err != nil || name != testCase.expect {
+			t.Error("#", index, testCase.name, "Expected", testCase.expect, "Got", name, err, "Failed")
+		}
+	}
+	if name, err := CountyName("台北", "en"); err != nil || name != "Taipei City" {
+		t.Error("Expected Taipei City", "Got", name, err, "Failed")
+	}
+
+	// every county is matched by each of its names in both datasets
+	en := loadTestDataset(t, "F-C0032-002.xml")
+	zh := loadTestDataset(t, "F-C0032-001.xml")
+	meteo := newCwdMeteo("", "en", nil)
+	for _, c := range countyTable {
+		for _, name := range []string{c.zh, c.en, c.cn, strings.Replace(c.zh, "臺", "台", -1)} {
+			if _, err := meteo.dataOfLocation(en, name); err != nil {
+				t.Error(name, "Expected location in en dataset", "Got", err, "Failed")
+			}
+			if _, err := meteo.dataOfLocation(zh, name); err != nil {
+				t.Error(name, "Expected location in zh-TW dataset", "Got", err, "Failed")
+			}
+		}
+	}
+}
+
+func TestLanguageDataset(t *testing.T) {
+
+	defer sharedDatasetCache.clear()
+	for _, file := range []string{"F-C0032-001", "F-C0032-002"} {
+		raw, err := ioutil.ReadFile("../testCase/" + file + ".xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := Weathers{}
+		if err := xml.Unmarshal(raw, &data); err != nil {
+			t.Fatal(err)
+		}
+		sharedDatasetCache.get(file, time.Hour, func() (interface{}, *datasetInfo, error) {
+			return &data, &data.DataSet.DatasetInfo, nil
+		})
+	}
+
+	// the fixtures are issued at different days, so each language finds its own periods
+	zhTime := time.Date(2016, 8, 27, 13, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	enTime := time.Date(2016, 9, 9, 19, 0, 0, 0, time.FixedZone("CST", 8*3600))
+
+	for _, language := range []string{"zh-TW", "zh", "en"} {
+		meteo := newCwdMeteo("", language, nil)
+		at, other := enTime, zhTime
+		if isChinese(language) {
+			at, other = zhTime, enTime
+		}
+		for _, name := range []string{"Taipei City", "台北市", "臺北市"} {
+			if _, err := meteo.getWeather(name, at); err != nil {
+				t.Error(language, name, "Expected weather", "Got", err, "Failed")
+			}
+			if _, err := meteo.getWeather(name, other); err == nil {
+				t.Error(language, name, "Expected no weather of other dataset", "Failed")
+			}
+		}
+	}
+}
+
+type summaryTestCase struct {
+	weather Weather
+	en      string
+	zh      string
+}
+
+func TestSummary(t *testing.T) {
+
+	testCases := []summaryTestCase{
+		{
+			Weather{Wx: WX_MOSTLY + WX_CLEAR, MinTemp: 27, MaxTemp: 33, Pop: 20},
+			"Mostly clear, 27–33°C, 20% chance of rain",
+			"晴時多雲，27–33°C，降雨機率 20%",
+		},
+		{
+			Weather{Wx: WX_MOSTLY + WX_CLOUDY + WX_OCCASIONAL + WX_SHOWERS, MinTemp: 26, MaxTemp: 30, Pop: 60, ComfortIndex: CI_COMFORTABLE + CI_HOT},
+			"Mostly cloudy with occasional showers, 26–30°C, 60% chance of rain, comfortable to hot",
+			"多雲時陰短暫陣雨，26–30°C，降雨機率 60%，舒適至悶熱",
+		},
+		{
+			Weather{Wx: WX_PARTLY + WX_CLOUDY + WX_AFTERNOON + WX_OCCASIONAL + WX_THUNDERSHOWERS, MinTemp: 29, MaxTemp: 29, Pop: 30},
+			"Partly cloudy with afternoon occasional thundershowers, 29°C, 30% chance of rain",
+			"多雲午後短暫雷陣雨，29°C，降雨機率 30%",
+		},
+		{
+			Weather{Wx: WX_CLOUDY + WX_SHOWERS + WX_THUNDERSTORMS, MinTemp: 24, MaxTemp: 28, Pop: 70},
+			"Cloudy with showers or thunderstorms, 24–28°C, 70% chance of rain",
+			"陰陣雨或雷雨，24–28°C，降雨機率 70%",
+		},
+		{
+			Weather{Wx: WX_PARTLY + WX_CLOUDY, MinTemp: 29, MaxTemp: 29, Temp: 29, TempKnown: true, ApparentTemp: 33, ApparentTempKnown: true, Pop: 20, UVIndex: 9},
+			"Partly cloudy, 29°C, feels like 33°C, 20% chance of rain, UV 9 (very high)",
+			"多雲，29°C，體感 33°C，降雨機率 20%，紫外線 9 過量級",
+		},
+		{
+			Weather{Wx: WX_LIGHTLY + WX_RAIN + WX_FOG, MinTemp: 12, MaxTemp: 15, Pop: 80, ComfortIndex: CI_COLD},
+			"Light rain and fog, 12–15°C, 80% chance of rain, cold",
+			"小雨有霧，12–15°C，降雨機率 80%，寒冷",
+		},
+	}
+
+	for index, testCase := range testCases {
+		if res := testCase.weather.Summary("en"); res != testCase.en {
+			t.Error("#", index, "Expected", testCase.en, "Got", res, "Failed")
+		}
+		if res := testCase.weather.Summary("zh-TW"); res != testCase.zh {
+			t.Error("#", index, "Expected", testCase.zh, "Got", res, "Failed")
+		}
+		// the phrase must be decoded back into the same flags
+		for _, zh := range []bool{false, true} {
+			if wx := decodeWx(wxText(testCase.weather.Wx, zh), 0); wx != testCase.weather.Wx {
+				t.Error("#", index, "Expected", testCase.weather.Wx, "Got", wx, "from", wxText(testCase.weather.Wx, zh), "Failed")
+			}
+		}
+	}
+
+	// CWB forecasts have comfort index, so the comfort range ends the summary
+	meteo := newCwdMeteo("", "", nil)
+	weather, err := meteo.weatherOfPeriod(*mustLocation(t, "F-C0032-001.xml", "Taipei City"), "2016-08-27T18:00:00+08:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := weather.Summary("en"); res != "Mostly cloudy with occasional showers, 26–30°C, 30% chance of rain, comfortable to hot" {
+		t.Error("Expected summary of CWB forecast", "Got", res, "Failed")
+	}
+	if res := weather.Summary("zh-TW"); res != "多雲時陰短暫陣雨，26–30°C，降雨機率 30%，舒適至悶熱" {
+		t.Error("Expected summary of CWB forecast", "Got", res, "Failed")
+	}
+
+	if res := testCases[0].weather.Summary("fr"); res != testCases[0].en {
+		t.Error("Expected en for unknown language", "Got", res, "Failed")
+	}
+}
+
+type testArchiver struct {
+	records []ArchiveRecord
+}
+
+func (archiver *testArchiver) Archive(record ArchiveRecord) error {
+	archiver.records = append(archiver.records, record)
+	return nil
+}
+
+func TestArchive(t *testing.T) {
+
+	raw, err := ioutil.ReadFile("../testCase/F-C0032-002.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archiver := &testArchiver{}
+	handler, err := newMeteoHandler(METEO_SOURCE_CWB, Config{Archiver: archiver}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meteo := handler.(*cwdMeteo)
+
+	meteo.archive("F-C0032-002", "2016-09-09T17:00:00+08:00", raw)
+	meteo.archive("F-C0032-002", "not a time", raw)
+	if len(archiver.records) != 1 {
+		t.Fatal("Expected 1 record", "Got", len(archiver.records), "Failed")
+	}
+	record := archiver.records[0]
+	issueTime, _ := time.Parse(time.RFC3339, "2016-09-09T17:00:00+08:00")
+	if record.DataId != "F-C0032-002" || !record.IssueTime.Equal(issueTime) || len(record.Raw) != len(raw) {
+		t.Error("Expected record of F-C0032-002 at", issueTime, "Got", record.DataId, record.IssueTime, "Failed")
+	}
+
+	// the archived forecast answers the weather of the past time
+	pastTime := time.Date(2016, 9, 9, 20, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	weather, err := WeatherOfArchive(record, "臺北市", pastTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect, err := meteo.weatherOfPeriod(*mustLocation(t, "F-C0032-002.xml", "Taipei City"), "2016-09-09T18:00:00+08:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect.Source = METEO_SOURCE_CWB
+	if *weather != *expect {
+		t.Error("Expected", expect, "Got", weather, "Failed")
+	}
+
+	if _, err := WeatherOfArchive(record, "Taipei City", pastTime.AddDate(0, 1, 0)); err == nil {
+		t.Error("Expected error for time out of the dataset", "Failed")
+	}
+	// the first period starts at 18:00, the nearest period is not used for the past
+	if weather, err := WeatherOfArchive(record, "Taipei City", issueTime); err == nil {
+		t.Error("Expected error for time before the first period", "Got", weather, "Failed")
+	}
+	if _, err := WeatherOfArchive(record, "Taipei City", pastTime.Add(-2*time.Hour)); err != nil {
+		t.Error("Expected weather at the start of the first period", "Got", err, "Failed")
+	}
+	if _, err := WeatherOfArchive(ArchiveRecord{DataId: "O-A0001-001", Raw: raw}, "Taipei City", pastTime); err == nil {
+		t.Error("Expected error for dataset which is not forecast", "Failed")
+	}
+
+	// the archived observation replaces measured elements of forecast
+	rawObservation, err := ioutil.ReadFile("../testCase/O-A0001-001.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ObservationOfArchive(record, 25.0340, 121.5645, pastTime); err == nil {
+		t.Error("Expected error for dataset which is not observation", "Failed")
+	}
+	obs, err := ObservationOfArchive(ArchiveRecord{DataId: CENTRAL_WEATHER_BUREAU_OBSERVATION_ID, Raw: rawObservation}, 25.0340, 121.5645, pastTime)
+	if err != nil || obs.StationId != "C0AC70" || obs.Age != pastTime.Sub(obs.ObsTime) {
+		t.Fatal("Expected observation of C0AC70", "Got", obs, err, "Failed")
+	}
+	observed := *weather
+	obs.Apply(&observed)
+	if observed.Temp != 31 || !observed.TempKnown || observed.Humidity != 66 || observed.WindSpeed != 2.4 || !observed.ApparentTempKnown || observed.Wx != weather.Wx || observed.MaxTemp != weather.MaxTemp {
+		t.Error("Expected measured elements of C0AC70 in forecast", "Got", observed, "Failed")
+	}
+	observed = *weather
+	(&Observation{}).Apply(&observed)
+	if observed != *weather {
+		t.Error("Expected forecast without measured elements", "Got", observed, "Failed")
+	}
+}
+
+func mustLocation(t *testing.T, file string, name string) *location {
+
+	meteo := newCwdMeteo("", "", nil)
+	data, err := meteo.dataOfLocation(loadTestDataset(t, file), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestStreamDecoder(t *testing.T) {
+
+	for _, file := range []string{"F-C0032-001.xml", "F-C0032-002.xml"} {
+		raw, err := ioutil.ReadFile("../testCase/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := Weathers{}
+		if err := xml.Unmarshal(raw, &expect); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := decodeWeathers(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.DataId != expect.DataId || data.DataSet.DatasetInfo != expect.DataSet.DatasetInfo {
+			t.Error(file, "Expected", expect.DataId, expect.DataSet.DatasetInfo, "Got", data.DataId, data.DataSet.DatasetInfo, "Failed")
+		}
+		if !reflect.DeepEqual(data.DataSet.Locations, expect.DataSet.Locations) {
+			t.Error(file, "Expected the same locations as xml.Unmarshal", "Failed")
+		}
+		if len(data.DataSet.index) != len(countyTable) {
+			t.Error(file, "Expected index of", len(countyTable), "counties", "Got", len(data.DataSet.index), "Failed")
+		}
+
+		meteo := newCwdMeteo("", "", nil)
+		for _, c := range countyTable {
+			indexed, err := meteo.dataOfLocation(data.DataSet, c.en)
+			if err != nil {
+				t.Error(file, c.en, "Expected indexed location", "Got", err, "Failed")
+				continue
+			}
+			single, info, err := decodeLocationOf(bytes.NewReader(raw), c.zh)
+			if err != nil {
+				t.Error(file, c.zh, "Expected single location", "Got", err, "Failed")
+				continue
+			}
+			if single.LocationName != indexed.LocationName || !reflect.DeepEqual(single.WeatherElements, indexed.WeatherElements) {
+				t.Error(file, c.zh, "Expected", indexed.LocationName, "Got", single.LocationName, "Failed")
+			}
+			if info.IssueTime != expect.DataSet.DatasetInfo.IssueTime {
+				t.Error(file, "Expected issue time", expect.DataSet.DatasetInfo.IssueTime, "Got", info.IssueTime, "Failed")
+			}
+		}
+
+		if _, _, err := decodeLocationOf(bytes.NewReader(raw), "Atlantis"); err == nil {
+			t.Error(file, "Expected error for unknown location", "Failed")
+		}
+	}
+
+	// the other datasets are decoded from the stream as a whole
+	for file, newDataset := range map[string]func() interface{}{
+		"F-D0047-061.xml": func() interface{} { return &townshipWeathers{} },
+		"W-C0033-001.xml": func() interface{} { return &warningWeathers{} },
+		"O-A0001-001.xml": func() interface{} { return &observationWeathers{} },
+		"O-A0002-001.xml": func() interface{} { return &observationWeathers{} },
+		"F-B0046-001.xml": func() interface{} { return &nowcastWeathers{} },
+	} {
+		raw, err := ioutil.ReadFile("../testCase/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect, data := newDataset(), newDataset()
+		if err := xml.Unmarshal(raw, expect); err != nil {
+			t.Fatal(err)
+		}
+		if err := decodeXml(iotest.OneByteReader(bytes.NewReader(raw)), data); err != nil {
+			t.Error(file, "Expected no error", "Got", err, "Failed")
+			continue
+		}
+		if !reflect.DeepEqual(data, expect) {
+			t.Error(file, "Expected the same dataset as xml.Unmarshal", "Failed")
+		}
+	}
+
+	if _, err := decodeWeathers(strings.NewReader("<cwbopendata><dataset><location>")); err == nil {
+		t.Error("Expected error for truncated xml", "Failed")
+	}
+}
+
+func benchmarkFixture(b *testing.B, file string) []byte {
+
+	raw, err := ioutil.ReadFile("../testCase/" + file)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return raw
+}
+
+/**
+ * Lookup of one location by decoding the whole xml tree, as it was before streaming
+ */
+func BenchmarkUnmarshalLookup(b *testing.B) {
+
+	for _, file := range []string{"F-C0032-001.xml", "F-C0032-002.xml"} {
+		raw := benchmarkFixture(b, file)
+		meteo := newCwdMeteo("", "", nil)
+		b.Run(file, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				v := Weathers{}
+				if err := xml.Unmarshal(raw, &v); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := meteo.dataOfLocation(v.DataSet, "Lienchiang County"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+/**
+ * Lookup of one location after decoding and indexing the whole stream, as a cache miss
+ */
+func BenchmarkDecodeLookup(b *testing.B) {
+
+	for _, file := range []string{"F-C0032-001.xml", "F-C0032-002.xml"} {
+		raw := benchmarkFixture(b, file)
+		meteo := newCwdMeteo("", "", nil)
+		b.Run(file, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				v, err := decodeWeathers(bytes.NewReader(raw))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := meteo.dataOfLocation(v.DataSet, "Lienchiang County"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+/**
+ * Decoding only one location from the stream, the first and the last location of dataset
+ */
+func BenchmarkDecodeLocationOf(b *testing.B) {
+
+	for _, file := range []string{"F-C0032-001.xml", "F-C0032-002.xml"} {
+		raw := benchmarkFixture(b, file)
+		for _, name := range []string{"Taipei City", "Lienchiang County"} {
+			b.Run(file+"/"+name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, _, err := decodeLocationOf(bytes.NewReader(raw), name); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+/**
+ * Weather of one location from the cached dataset, the hot path of api server
+ */
+func BenchmarkCachedLookup(b *testing.B) {
+
+	for _, file := range []string{"F-C0032-001.xml", "F-C0032-002.xml"} {
+		v, err := decodeWeathers(bytes.NewReader(benchmarkFixture(b, file)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		meteo := newCwdMeteo("", "", nil)
+		b.Run(file, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := meteo.dataOfLocation(v.DataSet, "Lienchiang County")
+				if err != nil {
+					b.Fatal(err)
+				}
+				wx, err := meteo.getElement(*data, "Wx")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := meteo.weatherOfPeriod(*data, wx.Time[0].StartTime); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+type sunTestCase struct {
+	lat     float64
+	lng     float64
+	date    time.Time
+	sunrise string // local time, empty if the sun does not rise or set
+	sunset  string
+	dawn    string
+	dusk    string
+}
+
+func TestSunTimes(t *testing.T) {
+
+	taipei := time.FixedZone("CST", 8*3600)
+	london := time.UTC
+
+	testCases := []sunTestCase{
+		{25.0330, 121.5654, time.Date(2016, 6, 21, 12, 0, 0, 0, taipei), "05:04", "18:47", "04:38", "19:13"},
+		{25.0330, 121.5654, time.Date(2016, 12, 21, 12, 0, 0, 0, taipei), "06:33", "17:10", "06:08", "17:35"},
+		{51.5074, -0.1278, time.Date(2016, 12, 21, 0, 0, 0, 0, london), "08:04", "15:54", "07:24", "16:34"},
+		// polar night and polar day in Tromsø
+		{69.6492, 18.9553, time.Date(2016, 12, 21, 12, 0, 0, 0, time.UTC), "", "", "", ""},
+		{69.6492, 18.9553, time.Date(2016, 6, 21, 12, 0, 0, 0, time.UTC), "", "", "", ""},
+	}
+
+	within := func(got time.Time, expect string, date time.Time) bool {
+		clock, _ := time.ParseInLocation("15:04", expect, date.Location())
+		y, m, d := date.Date()
+		want := time.Date(y, m, d, clock.Hour(), clock.Minute(), 0, 0, date.Location())
+		diff := got.Sub(want)
+		return diff < 4*time.Minute && diff > -4*time.Minute
+	}
+
+	for index, testCase := range testCases {
+		times, err := SunTimesOf(testCase.lat, testCase.lng, testCase.date)
+		if testCase.sunrise == "" {
+			if err == nil {
+				t.Error("#", index, "Expected no sunrise", "Got", times, "Failed")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("#", index, "Expected no error", "Got", err, "Failed")
+			continue
+		}
+		for _, pair := range []struct {
+			got    time.Time
+			expect string
+		}{
+			{times.Sunrise, testCase.sunrise},
+			{times.Sunset, testCase.sunset},
+			{times.CivilDawn, testCase.dawn},
+			{times.CivilDusk, testCase.dusk},
+		} {
+			if !within(pair.got, pair.expect, testCase.date) {
+				t.Error("#", index, "Expected", pair.expect, "Got", pair.got.Format("2006-01-02 15:04"), "Failed")
+			}
+		}
+		if times.DayLength != times.Sunset.Sub(times.Sunrise) || times.SolarNoon.Before(times.Sunrise) || times.SolarNoon.After(times.Sunset) {
+			t.Error("#", index, "Expected solar noon in the day", "Got", times, "Failed")
+		}
+	}
+
+	// the sun is nearly overhead at noon of summer solstice in Taipei
+	noon, _ := SunTimesOf(25.0330, 121.5654, testCases[0].date)
+	if elevation := SolarElevation(25.0330, 121.5654, noon.SolarNoon); elevation < 88 || elevation > 89 {
+		t.Error("Expected elevation about 88.4", "Got", elevation, "Failed")
+	}
+	if IsDark(25.0330, 121.5654, noon.SolarNoon) || !IsDark(25.0330, 121.5654, noon.CivilDusk.Add(10*time.Minute)) {
+		t.Error("Expected daylight at noon and dark after civil dusk", "Failed")
+	}
+
+	if _, err := SunTimesOf(91, 0, time.Now()); err == nil {
+		t.Error("Expected error for invalid latitude", "Failed")
+	}
+}
+
+type suitabilityTestCase struct {
+	weather  Weather
+	score    int
+	distance int
+}
+
+func TestSuitability(t *testing.T) {
+
+	if err := DefaultSuitabilityTable.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []suitabilityTestCase{
+		// a fine day
+		{Weather{Wx: WX_MOSTLY + WX_CLEAR, MinTemp: 22, MaxTemp: 27, Pop: 0, ComfortIndex: CI_COMFORTABLE}, 100, 1500},
+		// occasional showers are not as bad as showers
+		{Weather{Wx: WX_PARTLY + WX_CLOUDY + WX_OCCASIONAL + WX_SHOWERS, MinTemp: 24, MaxTemp: 29, Pop: 30, ComfortIndex: CI_COMFORTABLE}, 75, 800},
+		{Weather{Wx: WX_CLOUDY + WX_SHOWERS, MinTemp: 24, MaxTemp: 29, Pop: 30, ComfortIndex: CI_COMFORTABLE}, 65, 800},
+		// summer afternoon thunderstorms
+		{Weather{Wx: WX_CLOUDY + WX_SHOWERS + WX_THUNDERSTORMS, MinTemp: 27, MaxTemp: 34, Pop: 70, ComfortIndex: CI_HOT + CI_VERY_HOT}, 0, 100},
+		// a cold front
+		{Weather{Wx: WX_CLOUDY + WX_LIGHTLY + WX_RAIN, MinTemp: 10, MaxTemp: 13, Pop: 50, ComfortIndex: CI_VERY_COLD + CI_COLD}, 30, 100},
+		{Weather{Wx: WX_CLEAR, MinTemp: 14, MaxTemp: 19, Pop: 10, ComfortIndex: CI_COLD + CI_CHILLY}, 84, 1500},
+	}
+
+	for index, testCase := range testCases {
+		res := testCase.weather.OutingSuitability()
+		if res.Score != testCase.score || res.MaxDistance != testCase.distance {
+			t.Error("#", index, "Expected", testCase.score, testCase.distance, "Got", res, "Failed")
+		}
+		if (res.Score == SUITABILITY_SCORE_BEST) != (len(res.Reasons) == 0) {
+			t.Error("#", index, "Expected reasons for lost score", "Got", res.Reasons, "Failed")
+		}
+	}
+
+	// the table is configurable
+	table := SuitabilityTable{
+		Wx:        []WxPenalty{{"showers", 50}},
+		Distances: []DistanceStep{{0, 50}, {60, 2000}},
+		TempLow:   0,
+		TempHigh:  40,
+	}
+	if err := table.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if res := table.Score(&testCases[2].weather); res.Score != 50 || res.MaxDistance != 50 {
+		t.Error("Expected", 50, 50, "Got", res, "Failed")
+	}
+	if res := table.Score(&testCases[0].weather); res.Score != 100 || res.MaxDistance != 2000 {
+		t.Error("Expected", 100, 2000, "Got", res, "Failed")
+	}
+
+	for _, invalid := range []SuitabilityTable{
+		{Wx: []WxPenalty{{"sandstorm", 10}}, Distances: table.Distances},
+		{Comfort: []ComfortPenalty{{"lukewarm", 10}}, Distances: table.Distances},
+		{TempLow: 30, TempHigh: 20, Distances: table.Distances},
+		{},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Error("Expected invalid table", invalid, "Failed")
+		}
+	}
+}
+
+type nowcastTestCase struct {
+	lat    float64
+	lng    float64
+	time   string
+	rains  []float64
+	first  string
+	within bool // rain within 10 minutes
+}
+
+func TestNowcast(t *testing.T) {
+
+	raw, err := ioutil.ReadFile("../testCase/F-B0046-001.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := nowcastWeathers{}
+	if err := xml.Unmarshal(raw, &data); err != nil {
+		t.Fatal(err)
+	}
+	if err := data.DataSet.parseGrid(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []nowcastTestCase{
+		// Taipei 101, the rain band moves from the west
+		{25.0340, 121.5645, "2016-09-09T17:10:00+08:00", []float64{0, 0, 0.5, 1.5, 3.0, 3.0}, "2016-09-09T17:30:00+08:00", false},
+		// the data is 15 minutes old, the steps which have ended are dropped
+		{25.0340, 121.5645, "2016-09-09T17:25:00+08:00", []float64{0, 0.5, 1.5, 3.0, 3.0}, "2016-09-09T17:30:00+08:00", true},
+		// Shezi, it is raining already
+		{25.1090, 121.4700, "2016-09-09T17:10:00+08:00", []float64{0.5, 1.5, 3.0, 3.0, 3.0, 3.0}, "2016-09-09T17:10:00+08:00", true},
+		// Yangmingshan, dry in the north
+		{25.1550, 121.5200, "2016-09-09T17:10:00+08:00", []float64{0, 0, 0, 0, 0, 0}, "", false},
+	}
+
+	for index, testCase := range testCases {
+		now, _ := time.Parse(time.RFC3339, testCase.time)
+		nowcast, err := nowcastOfLatlng(&data.DataSet, testCase.lat, testCase.lng, now)
+		if err != nil {
+			t.Error("#", index, "Expected no error", "Got", err, "Failed")
+			continue
+		}
+		rains := []float64{}
+		for _, step := range nowcast.Steps {
+			rains = append(rains, step.Rain)
+		}
+		if !reflect.DeepEqual(rains, testCase.rains) {
+			t.Error("#", index, "Expected", testCase.rains, "Got", rains, "Failed")
+		}
+		first := ""
+		if step := nowcast.FirstRain(); step != nil {
+			first = step.StartTime.Format(time.RFC3339)
+		}
+		if first != testCase.first {
+			t.Error("#", index, "Expected first rain at", testCase.first, "Got", first, "Failed")
+		}
+		if nowcast.RainsWithin(now, 10*time.Minute) != testCase.within {
+			t.Error("#", index, "Expected rain within 10 minutes", testCase.within, "Failed")
+		}
+	}
+
+	now, _ := time.Parse(time.RFC3339, "2016-09-09T17:10:00+08:00")
+	nowcast, _ := nowcastOfLatlng(&data.DataSet, 25.0340, 121.5645, now)
+	if nowcast == nil || math.Abs(nowcast.TotalRain()-8.0) > 1e-9 || nowcast.Lat != 24.95+2*0.05 || !nowcast.RainsWithin(now, 30*time.Minute) {
+		t.Error("Expected 8 mm in total from 17:30", "Got", nowcast, "Failed")
+	}
+
+	// out of grid, missing value at sea and out of date
+	if _, err := nowcastOfLatlng(&data.DataSet, 24.5, 120.9, now); err == nil {
+		t.Error("Expected error out of grid", "Failed")
+	}
+	if _, err := nowcastOfLatlng(&data.DataSet, 24.95, 121.65, now); err == nil {
+		t.Error("Expected error for missing value", "Failed")
+	}
+	if _, err := nowcastOfLatlng(&data.DataSet, 25.0340, 121.5645, now.Add(2*time.Hour)); err == nil {
+		t.Error("Expected error for out of date nowcast", "Failed")
+	}
+
+	// dry cells are 0 mm, not no data
+	dry := nowcastDataset{IssueTime: data.DataSet.IssueTime, Grid: nowcastGridInfo{Lat: 25, Lng: 121.5, Resolution: 0.05, DimensionX: 2, DimensionY: 1}, Contents: []nowcastContent{data.DataSet.Contents[0]}}
+	dry.Contents[0].Values = "0.00E+00,-99.00E+00"
+	if err := dry.parseGrid(); err != nil {
+		t.Fatal(err)
+	}
+	if nowcast, err := nowcastOfLatlng(&dry, 25, 121.5, now); err != nil || nowcast.TotalRain() != 0 || nowcast.FirstRain() != nil {
+		t.Error("Expected no rain in dry cell", "Got", nowcast, err, "Failed")
+	}
+	if _, err := nowcastOfLatlng(&dry, 25, 121.55, now); err == nil {
+		t.Error("Expected error for no data", "Failed")
+	}
+
+	invalid := nowcastDataset{Grid: nowcastGridInfo{Resolution: 0.05, DimensionX: 2, DimensionY: 2}, Contents: []nowcastContent{{Values: "0,0,0"}}}
+	if err := invalid.parseGrid(); err == nil {
+		t.Error("Expected error for wrong number of values", "Failed")
+	}
+}
+
+type weatherAtTestCase struct {
+	time   string
+	expect int // maxTemp, 0 if no period answers
+}
+
+/**
+ * Test job for period lookup on boundaries and injected clock
+ */
+func TestWeatherAt(t *testing.T) {
+
+	meteo := newCwdMeteo("", "en", nil)
+	data := loadTestDataset(t, "F-C0032-002.xml")
+
+	location, err := meteo.dataOfLocation(data, "Taipei City")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []weatherAtTestCase{
+		// the start of period is inclusive
+		{"2016-09-09T18:00:00+08:00", 28},
+		{"2016-09-10T06:00:00+08:00", 32},
+		{"2016-09-10T18:00:00+08:00", 29},
+		// the same time in UTC
+		{"2016-09-09T10:00:00Z", 28},
+		// just issued, before the first period
+		{"2016-09-09T17:00:00+08:00", 28},
+		// the end of the last period
+		{"2016-09-11T06:00:00+08:00", 29},
+		// too far from every period
+		{"2016-09-12T00:00:00+08:00", 0},
+	}
+
+	for index, testCase := range testCases {
+		at, _ := time.Parse(time.RFC3339, testCase.time)
+		wx, err := meteo.getParameter(*location, at, "Wx")
+		if testCase.expect == 0 {
+			if err == nil {
+				t.Error("#", index, "Expected error", "Got", wx, "Failed")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("#", index, "Expected", testCase.expect, "Got", err, "Failed")
+			continue
+		}
+		weather, err := meteo.weatherOfPeriod(*location, wx.StartTime)
+		if err != nil || weather.MaxTemp != testCase.expect {
+			t.Error("#", index, "Expected", testCase.expect, "Got", weather, err, "Failed")
+		}
+	}
+
+	forecasts, err := meteo.forecastOfLocation(*location, time.Date(2016, 9, 9, 10, 0, 0, 0, time.UTC), time.Date(2016, 9, 9, 11, 0, 0, 0, time.UTC))
+	if err != nil || forecasts[0].StartTime.Location() != CWB_TIME_ZONE || forecasts[0].StartTime.Hour() != 18 {
+		t.Error("Expected period starts at 18:00 in +08:00", "Got", forecasts, err, "Failed")
+	}
+
+	// the snapshot is regarded as issued at the time of clock
+	now := time.Date(2016, 9, 9, 9, 30, 0, 0, time.UTC)
+	fileMeteo, err := NewMeteorologyByConfig(Config{Source: METEO_SOURCE_FILE, Language: "en", Snapshot: "../testCase", Clock: NewFixedClock(now)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileMeteo.Now().Equal(now) || fileMeteo.Now().Location() != CWB_TIME_ZONE {
+		t.Error("Expected", now, "in +08:00", "Got", fileMeteo.Now(), "Failed")
+	}
+	if weather, err := fileMeteo.GetWeather("Taipei City"); err != nil || weather.MaxTemp != 28 {
+		t.Error("Expected 28 now", "Got", weather, err, "Failed")
+	}
+	if weather, err := fileMeteo.GetWeatherAt("Taipei City", now.Add(13*time.Hour)); err != nil || weather.MaxTemp != 32 {
+		t.Error("Expected 32 13 hours later", "Got", weather, err, "Failed")
+	}
+
+	// 22:30 UTC is the next morning in Taiwan
+	sunMeteo, _ := NewMeteorologyByConfig(Config{Source: METEO_SOURCE_FILE, Clock: NewFixedClock(time.Date(2016, 9, 9, 22, 30, 0, 0, time.UTC))}, nil)
+	sun, err := sunMeteo.GetSunTimes(25.0340, 121.5645)
+	if err != nil || sun.Sunrise.Day() != 10 || sun.Sunrise.Location() != CWB_TIME_ZONE {
+		t.Error("Expected sunrise on 09/10 in +08:00", "Got", sun, err, "Failed")
+	}
+	if sunMeteo.IsDark(25.0340, 121.5645) {
+		t.Error("Expected daylight at 06:30 in Taipei", "Failed")
+	}
+
+	if SystemClock.Now().Location() != CWB_TIME_ZONE {
+		t.Error("Expected system clock in +08:00", "Failed")
+	}
+}
@@ -9,38 +9,53 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/kr/pretty"
 	"github.com/xu354cjo1008/eatingFinder/httpHandler"
 )
 
 const (
-	OPEN_WEATHER_MAP_API      string = "http://api.openweathermap.org/data/2.5/%s?q=%s,%s&APPID=%s"
+	OPEN_WEATHER_MAP_URL      string = "http://api.openweathermap.org/data/2.5"
+	OPEN_WEATHER_MAP_API      string = "%s/%s?q=%s,%s&APPID=%s&lang=%s"
 	OPEN_WEATHER_MAP_WEATHER  string = "weather"
 	OPEN_WEATHER_MAP_FORECAST string = "forecast"
+	OPEN_WEATHER_MAP_COUNTRY  string = "TW"
+	OPEN_WEATHER_MAP_UVI      string = "%s/uvi?lat=%s&lon=%s&APPID=%s"
+)
+
+/**
+ * The period length of one item in forecast list and
+ * the period used to estimate probability of precipitation for current weather
+ */
+const (
+	owmForecastPeriod = 3 * time.Hour
+	owmPopPeriod      = 12 * time.Hour
 )
 
 type owmMeteo struct {
 	apiKey   string
 	language string
+	baseUrl  string
 	logLevel int
 	logger   *log.Logger
-	response map[string]interface{}
+	clock    Clock // current weather is only for the slot of now
 }
 
-func (meteo *owmMeteo) request(city string, country string, reqType string) error {
+func (meteo *owmMeteo) request(city string, country string, reqType string) (map[string]interface{}, error) {
 
 	if meteo.apiKey == "" {
-		return errors.New("Invalid openWeatherMap api key")
+		return nil, errors.New("Invalid openWeatherMap api key")
 	}
 	if city == "" {
-		return errors.New("Invalid city name")
+		return nil, errors.New("Invalid city name")
 	}
 	if country == "" {
-		return errors.New("Invalid country name")
+		return nil, errors.New("Invalid country name")
 	}
 
 	var requestT string
@@ -50,126 +65,413 @@ func (meteo *owmMeteo) request(city string, country string, reqType string) erro
 		requestT = OPEN_WEATHER_MAP_WEATHER
 	case "forecast":
 		requestT = OPEN_WEATHER_MAP_FORECAST
+	default:
+		return nil, errors.New("Invalid openWeatherMap request type")
 	}
 
-	reqUrl := fmt.Sprintf(OPEN_WEATHER_MAP_API, requestT, city, country, meteo.apiKey)
+	language := strings.Replace(strings.ToLower(meteo.language), "-", "_", -1)
+	reqUrl := fmt.Sprintf(OPEN_WEATHER_MAP_API, meteo.baseUrl, requestT,
+		url.QueryEscape(city), url.QueryEscape(country), meteo.apiKey, language)
 
 	resp, err := httpHandler.HttpGet(reqUrl)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := json.Unmarshal(resp, &(meteo.response)); err != nil {
-		return err
+	var response map[string]interface{}
+	if err := json.Unmarshal(resp, &response); err != nil {
+		return nil, err
 	}
 
-	return nil
+	// cod is number in weather response but string in forecast response
+	if code := fmt.Sprint(response["cod"]); code != "200" {
+		return nil, fmt.Errorf("openWeatherMap returns %s: %v", code, response["message"])
+	}
+
+	if meteo.logLevel == 1 {
+		t, _ := json.MarshalIndent(response, "", "  ")
+		meteo.logger.Println("request", requestT, "raw data", string(t))
+	}
+
+	return response, nil
 }
 
-func (meteo *owmMeteo) fakeRequest(city string, country string, reqType string) error {
+/**
+ * @name resolveLocation
+ * @brief Transform the location name to the city name known by openWeatherMap
+ * @param location The location e.g. Taipei City, 臺北市, Hualien County
+ * @return string The city name e.g. Taipei, Hualien
+ */
+func (meteo *owmMeteo) resolveLocation(location string) string {
+
+	city := strings.TrimSpace(location)
+	if c, err := findCounty(city); err == nil {
+		city = c.en
+	}
+	for _, suffix := range []string{" city", " county"} {
+		if strings.HasSuffix(strings.ToLower(city), suffix) {
+			city = city[:len(city)-len(suffix)]
+		}
+	}
 
-	if meteo.apiKey == "" {
-		return errors.New("Invalid openWeatherMap api key")
+	return city
+}
+
+func (meteo *owmMeteo) getElement(response map[string]interface{}, name string) (map[string]interface{}, error) {
+
+	if len(response) == 0 {
+		return nil, errors.New("empty data in owmMeteo response")
 	}
-	if city == "" {
-		return errors.New("Invalid city name")
+
+	switch element := response[name].(type) {
+	case []interface{}:
+		if len(element) == 0 {
+			return nil, errors.New("empty data in the request element")
+		}
+		if data, ok := element[0].(map[string]interface{}); ok {
+			return data, nil
+		}
+	case map[string]interface{}:
+		return element, nil
 	}
-	if country == "" {
-		return errors.New("Invalid country name")
+
+	return nil, errors.New("empty data in the request element")
+}
+
+func (meteo *owmMeteo) getParameter(element map[string]interface{}, name string) (float64, error) {
+
+	if element == nil {
+		return 0, errors.New("empty data in request element")
 	}
 
-	r, _ := ioutil.ReadFile("testCase/openWeatherMapTaipeiForecast.json")
-	var forecast map[string]interface{}
-	if err := json.Unmarshal(r, &forecast); err != nil {
-		return err
+	parameter, ok := element[name].(float64)
+	if !ok {
+		return 0, errors.New("empty data in the request parameter")
 	}
 
-	if meteo.logLevel == 1 {
-		t, _ := json.MarshalIndent(forecast, "", "  ")
-		meteo.logger.Println("request forecast raw data", string(t))
+	return parameter, nil
+}
+
+func (meteo *owmMeteo) tempKToCel(temp float64) float64 {
+	return temp - 273.15
+}
+
+/**
+ * @name comfortIndex
+ * @brief Estimate CWB comfort index by temperature-humidity index
+ * THI = T - 0.55 * (1 - RH) * (T - 14)
+ * @param temp The temperature in celsius
+ * @param humidity The relative humidity in percent
+ * @return int The comfort index number
+ */
+func (meteo *owmMeteo) comfortIndex(temp float64, humidity float64) int {
+	return int(math.Floor(temp - 0.55*(1-humidity/100)*(temp-14) + 0.5))
+}
+
+/**
+ * @name weatherOfData
+ * @brief Parse current weather or one item of forecast list into Weather
+ * @param data The weather data with weather and main elements
+ * @return *Weather The weather, PoP is not filled
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *owmMeteo) weatherOfData(data map[string]interface{}) (*Weather, error) {
+
+	weather := Weather{}
+
+	element, err := meteo.getElement(data, "weather")
+	if err != nil {
+		return nil, err
 	}
+	desc, _ := element["description"].(string)
+	weather.Wx = decodeWx(desc, 0)
 
-	resp, err := ioutil.ReadFile("testCase/openWeatherMapTaipeiWeather.json")
+	element, err = meteo.getElement(data, "main")
+	if err != nil {
+		return nil, err
+	}
+	maxTemp, err := meteo.getParameter(element, "temp_max")
+	if err != nil {
+		return nil, err
+	}
+	minTemp, err := meteo.getParameter(element, "temp_min")
 	if err != nil {
-		fmt.Printf("File error: %v\n", err)
-		return err
+		return nil, err
+	}
+	weather.MaxTemp = roundCelsius(meteo.tempKToCel(maxTemp))
+	weather.MinTemp = roundCelsius(meteo.tempKToCel(minTemp))
+
+	temp, errTemp := meteo.getParameter(element, "temp")
+	humidity, errHumidity := meteo.getParameter(element, "humidity")
+	if errTemp == nil && errHumidity == nil {
+		ci := meteo.comfortIndex(meteo.tempKToCel(temp), humidity)
+		weather.ComfortIndex, weather.MinComfort, weather.MaxComfort = transformCIToEnum(strconv.Itoa(ci))
+	}
+	if errTemp == nil {
+		weather.Temp, weather.TempKnown = roundCelsius(meteo.tempKToCel(temp)), true
+	}
+	if errHumidity == nil {
+		weather.Humidity = int(math.Floor(humidity + 0.5))
+	}
+	if feelsLike, err := meteo.getParameter(element, "feels_like"); err == nil {
+		weather.ApparentTemp, weather.ApparentTempKnown = roundCelsius(meteo.tempKToCel(feelsLike)), true
 	}
 
-	if err := json.Unmarshal(resp, &(meteo.response)); err != nil {
-		return err
+	if element, err := meteo.getElement(data, "wind"); err == nil {
+		weather.WindSpeed, _ = meteo.getParameter(element, "speed")
 	}
-	if meteo.logLevel == 1 {
-		t, _ := json.MarshalIndent(meteo.response, "", "  ")
-		meteo.logger.Println("request weather raw data", string(t))
+
+	return &weather, nil
+}
+
+/**
+ * @name popOfData
+ * @brief Get probability of precipitation of one item of forecast list
+ * The pop field is used if it exists, otherwise it is 100 if rain is forecasted.
+ * @param data One item of forecast list
+ * @return int The probability of precipitation in percent
+ */
+func (meteo *owmMeteo) popOfData(data map[string]interface{}) int {
+
+	if pop, ok := data["pop"].(float64); ok {
+		return int(math.Floor(pop*100 + 0.5))
 	}
 
-	return nil
+	for _, name := range []string{"rain", "snow"} {
+		if element, err := meteo.getElement(data, name); err == nil {
+			if volume, err := meteo.getParameter(element, "3h"); err == nil && volume > 0 {
+				return 100
+			}
+		}
+	}
+
+	return 0
 }
 
-func (meteo *owmMeteo) getElement(name string) (map[string]interface{}, error) {
+/**
+ * @name forecastList
+ * @brief Get items of forecast list which overlap [from, to)
+ */
+func (meteo *owmMeteo) forecastList(response map[string]interface{}, from time.Time, to time.Time) []map[string]interface{} {
+
+	res := []map[string]interface{}{}
+
+	list, _ := response["list"].([]interface{})
+	for _, item := range list {
+		data, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		dt, ok := data["dt"].(float64)
+		if !ok {
+			continue
+		}
+		startTime := time.Unix(int64(dt), 0)
+		if startTime.Before(to) && startTime.Add(owmForecastPeriod).After(from) {
+			res = append(res, data)
+		}
+	}
 
-	if meteo.response == nil && len(meteo.response) == 0 {
-		return nil, errors.New("empty data in owmMeteo response")
+	return res
+}
+
+/**
+ * @name requestUvi
+ * @brief Get current UV index at the coordinate of weather response
+ * @param response The response of current weather with coord element
+ * @return int The UV index
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *owmMeteo) requestUvi(response map[string]interface{}) (int, error) {
+
+	coord, err := meteo.getElement(response, "coord")
+	if err != nil {
+		return 0, err
+	}
+	lat, err := meteo.getParameter(coord, "lat")
+	if err != nil {
+		return 0, err
+	}
+	lon, err := meteo.getParameter(coord, "lon")
+	if err != nil {
+		return 0, err
 	}
 
-	element := meteo.response[name]
+	reqUrl := fmt.Sprintf(OPEN_WEATHER_MAP_UVI, meteo.baseUrl,
+		strconv.FormatFloat(lat, 'f', -1, 64), strconv.FormatFloat(lon, 'f', -1, 64), meteo.apiKey)
+	resp, err := httpHandler.HttpGet(reqUrl)
+	if err != nil {
+		return 0, err
+	}
 
-	if element == nil {
-		return nil, errors.New("empty data in the request element")
+	var uvi map[string]interface{}
+	if err := json.Unmarshal(resp, &uvi); err != nil {
+		return 0, err
+	}
+	value, err := meteo.getParameter(uvi, "value")
+	if err != nil {
+		return 0, fmt.Errorf("openWeatherMap returns no UV index: %v", uvi["message"])
 	}
 
-	switch name {
-	case "weather":
-		return element.([]interface{})[0].(map[string]interface{}), nil
-	default:
-		return element.(map[string]interface{}), nil
+	return int(math.Floor(value + 0.5)), nil
+}
+
+/**
+ * @name forecastAt
+ * @brief Get the item of forecast list whose slot contains the time,
+ * the nearest item is used if the time is out of every slot by CWB_NEAREST_PERIOD at most
+ * @param response The response of forecast
+ * @param t The time we care about
+ * @return map[string]interface{} The item, nil if there is no item near the time
+ */
+func (meteo *owmMeteo) forecastAt(response map[string]interface{}, t time.Time) map[string]interface{} {
+
+	var nearest map[string]interface{}
+	var gap time.Duration
+
+	list, _ := response["list"].([]interface{})
+	for _, item := range list {
+		data, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		dt, ok := data["dt"].(float64)
+		if !ok {
+			continue
+		}
+		startTime := time.Unix(int64(dt), 0)
+		endTime := startTime.Add(owmForecastPeriod)
+		if !t.Before(startTime) && t.Before(endTime) {
+			return data
+		}
+		d := startTime.Sub(t)
+		if t.After(startTime) {
+			d = t.Sub(endTime)
+		}
+		if nearest == nil || d < gap {
+			nearest, gap = data, d
+		}
+	}
+
+	if nearest != nil && gap <= CWB_NEAREST_PERIOD {
+		return nearest
 	}
+
+	return nil
 }
 
-func (meteo *owmMeteo) getParameter(element map[string]interface{}, name string) (interface{}, error) {
+/**
+ * @name getWeatherAt
+ * @brief Get weather of the slot which contains the time from forecast list
+ * @param city The city name known by openWeatherMap
+ * @param t The time we care about
+ * @return *Weather The weather, PoP is the highest in owmPopPeriod from the time
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (meteo *owmMeteo) getWeatherAt(city string, t time.Time) (*Weather, error) {
+
+	forecast, err := meteo.request(city, OPEN_WEATHER_MAP_COUNTRY, "forecast")
+	if err != nil {
+		return nil, err
+	}
 
-	if element == nil {
-		return nil, errors.New("empty data in request element")
+	data := meteo.forecastAt(forecast, t)
+	if data == nil {
+		return nil, errors.New("can not find data for that time")
+	}
+
+	weather, err := meteo.weatherOfData(data)
+	if err != nil {
+		return nil, err
 	}
 
-	parameter := element[name]
-	if parameter == nil {
-		return nil, errors.New("empty data in the request parameter")
+	for _, data := range meteo.forecastList(forecast, t, t.Add(owmPopPeriod)) {
+		if pop := meteo.popOfData(data); pop > weather.Pop {
+			weather.Pop = pop
+		}
 	}
 
-	return parameter, nil
+	return weather, nil
 }
 
-func (meteo *owmMeteo) tempKToCel(temp float64) float64 {
-	return temp - 273.15
+/**
+ * Current weather is used if the time is within one slot of now,
+ * otherwise the weather is taken from forecast list
+ */
+func (meteo *owmMeteo) getWeather(location string, t time.Time) (*Weather, error) {
+
+	city := meteo.resolveLocation(location)
+
+	if gap := t.Sub(meteo.clock.Now()); gap <= -owmForecastPeriod || gap >= owmForecastPeriod {
+		return meteo.getWeatherAt(city, t)
+	}
+
+	current, err := meteo.request(city, OPEN_WEATHER_MAP_COUNTRY, "weather")
+	if err != nil {
+		return nil, err
+	}
+
+	weather, err := meteo.weatherOfData(current)
+	if err != nil {
+		return nil, err
+	}
+
+	// UV index is optional
+	if uvi, err := meteo.requestUvi(current); err == nil {
+		weather.UVIndex = uvi
+	} else if meteo.logLevel == 1 {
+		meteo.logger.Println("can not get UV index:", err)
+	}
+
+	forecast, err := meteo.request(city, OPEN_WEATHER_MAP_COUNTRY, "forecast")
+	if err != nil {
+		// current weather is still useful without PoP
+		if meteo.logLevel == 1 {
+			meteo.logger.Println("can not get forecast:", err)
+		}
+		return weather, nil
+	}
+
+	for _, data := range meteo.forecastList(forecast, t, t.Add(owmPopPeriod)) {
+		if pop := meteo.popOfData(data); pop > weather.Pop {
+			weather.Pop = pop
+		}
+	}
+
+	return weather, nil
 }
 
-func (meteo *owmMeteo) getWeather(location string, time time.Time) (*Weather, error) {
+func (meteo *owmMeteo) getForecast(location string, from time.Time, to time.Time) ([]Forecast, error) {
 
-	err := meteo.fakeRequest("Taipei", "Taiwan", "Weather")
-	//	err := meteo.request("Taipei", "Taiwan", "Weather")
+	forecast, err := meteo.request(meteo.resolveLocation(location), OPEN_WEATHER_MAP_COUNTRY, "forecast")
 	if err != nil {
 		return nil, err
 	}
 
-	var element map[string]interface{}
-	var parameter interface{}
-	weather := Weather{}
+	forecasts := []Forecast{}
+	for _, data := range meteo.forecastList(forecast, from, to) {
+		weather, err := meteo.weatherOfData(data)
+		if err != nil {
+			return nil, err
+		}
+		weather.Pop = meteo.popOfData(data)
+
+		startTime := time.Unix(int64(data["dt"].(float64)), 0)
+		forecasts = append(forecasts, Forecast{
+			StartTime: startTime,
+			EndTime:   startTime.Add(owmForecastPeriod),
+			Weather:   *weather,
+		})
+	}
 
-	element, _ = meteo.getElement("weather")
-	parameter, _ = meteo.getParameter(element, "description")
-	pretty.Println("weather: ", parameter)
-	weather.weather = transformWxToEnum(parameter.(string))
-	element, _ = meteo.getElement("main")
-	parameter, _ = meteo.getParameter(element, "temp_max")
-	weather.maxTemp = int(meteo.tempKToCel(parameter.(float64)))
-	parameter, _ = meteo.getParameter(element, "temp_min")
-	weather.minTemp = int(meteo.tempKToCel(parameter.(float64)))
+	if len(forecasts) == 0 {
+		return nil, errors.New("can not find data for that time range")
+	}
 
-	return &weather, nil
+	return forecasts, nil
 }
 
-func newOwmMeteo(apiKey string, language string, logFile io.Writer) *owmMeteo {
+func newOwmMeteo(apiKey string, language string, baseUrl string, logFile io.Writer) *owmMeteo {
 
 	var loggingLevel int
 	if logFile == nil {
@@ -178,11 +480,18 @@ func newOwmMeteo(apiKey string, language string, logFile io.Writer) *owmMeteo {
 		loggingLevel = 1
 	}
 
+	if baseUrl == "" {
+		baseUrl = OPEN_WEATHER_MAP_URL
+	}
+
 	meteo := owmMeteo{
 		apiKey:   apiKey,
+		language: language,
+		baseUrl:  strings.TrimSuffix(baseUrl, "/"),
 		logLevel: loggingLevel,
 		logger: log.New(logFile, "OwmMeteo: ",
 			log.Ldate|log.Ltime|log.Lshortfile),
+		clock: SystemClock,
 	}
 
 	return &meteo
@@ -0,0 +1,117 @@
+/****************************************************************************
+ * This file is the fallback chain of meteorology sources.                  *
+ * Sources are tried in order until one of them answers.                    *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type meteoProvider struct {
+	source  string
+	handler meteorology
+	health  ProviderHealth
+}
+
+/**
+ * Health counters of one meteorology source
+ */
+type ProviderHealth struct {
+	Source      string    `json:"source"`
+	Success     int       `json:"success"`
+	Failure     int       `json:"failure"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastFailure time.Time `json:"lastFailure"`
+}
+
+/**
+ * @name Health
+ * @brief Get health counters of every source in fallback order
+ * @return []ProviderHealth The health counters
+ */
+func (meteo *Meteorology) Health() []ProviderHealth {
+
+	meteo.mutex.Lock()
+	defer meteo.mutex.Unlock()
+
+	res := []ProviderHealth{}
+	for _, provider := range meteo.providers {
+		res = append(res, provider.health)
+	}
+
+	return res
+}
+
+/**
+ * Record the result of one request to the source
+ */
+func (meteo *Meteorology) record(provider *meteoProvider, err error) {
+
+	meteo.mutex.Lock()
+	defer meteo.mutex.Unlock()
+
+	if err == nil {
+		provider.health.Success++
+		return
+	}
+
+	provider.health.Failure++
+	provider.health.LastError = err.Error()
+	provider.health.LastFailure = meteo.clock.Now()
+}
+
+/**
+ * @name fallThrough
+ * @brief Call the request with every source in order until one succeeds
+ * @param request The request to one source
+ * @return string The source which answers
+ * @return error The errors of every source, this will be nil if one source answers
+ */
+func (meteo *Meteorology) fallThrough(request func(meteorology) error) (string, error) {
+
+	if len(meteo.providers) == 0 {
+		return "", errors.New("no meteorology source")
+	}
+
+	messages := []string{}
+	for _, provider := range meteo.providers {
+		err := request(provider.handler)
+		meteo.record(provider, err)
+		if err == nil {
+			return provider.source, nil
+		}
+		messages = append(messages, provider.source+": "+err.Error())
+	}
+
+	return "", fmt.Errorf("all meteorology sources failed (%s)", strings.Join(messages, "; "))
+}
+
+/**
+ * Create the handler of one meteorology source
+ */
+func newMeteoHandler(source string, conf Config, logFile io.Writer) (meteorology, error) {
+
+	switch source {
+	case METEO_SOURCE_CWB, "":
+		handler := newCwdMeteo(conf.ApiKey, conf.Language, logFile)
+		handler.cacheTTL = conf.CacheTTL
+		handler.archiver = conf.Archiver
+		handler.nowcastDataId = conf.NowcastDataId
+		return handler, nil
+	case METEO_SOURCE_OWM:
+		handler := newOwmMeteo(conf.OwmApiKey, conf.Language, conf.OwmUrl, logFile)
+		handler.clock = conf.Clock
+		return handler, nil
+	case METEO_SOURCE_FILE:
+		handler := newFileMeteo(conf.Snapshot, conf.Language, logFile)
+		handler.clock = conf.Clock
+		return handler, nil
+	}
+
+	return nil, fmt.Errorf("unknown meteorology source: %s", source)
+}
@@ -0,0 +1,207 @@
+/****************************************************************************
+ * This file is solar calculator of sunrise, sunset and civil twilight.     *
+ * It follows the equations of NOAA solar calculator and works offline.     *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+/**
+ * Zenith of the sun in degrees at sunrise and sunset, including atmospheric refraction
+ * and radius of the sun, and at the begin and end of civil twilight
+ */
+const (
+	SOLAR_ZENITH_OFFICIAL = 90.833
+	SOLAR_ZENITH_CIVIL    = 96.0
+)
+
+/**
+ * It is dark when the sun is lower than this elevation in degrees
+ */
+const SOLAR_ELEVATION_DARK = 90.0 - SOLAR_ZENITH_CIVIL
+
+/**
+ * Sun times of one day, civil dawn and dusk are zero if the sun never goes
+ * below civil twilight e.g. white nights at high latitude
+ */
+type SunTimes struct {
+	Sunrise   time.Time     `json:"sunrise" bson:"sunrise"`
+	Sunset    time.Time     `json:"sunset" bson:"sunset"`
+	CivilDawn time.Time     `json:"civilDawn" bson:"civilDawn"`
+	CivilDusk time.Time     `json:"civilDusk" bson:"civilDusk"`
+	SolarNoon time.Time     `json:"solarNoon" bson:"solarNoon"`
+	DayLength time.Duration `json:"dayLength" bson:"dayLength"`
+}
+
+var errNoSunrise = errors.New("the sun does not rise or set on that day")
+
+func degToRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radToDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+/**
+ * @name solarPosition
+ * @brief Get declination of the sun and the equation of time
+ * @param t The time
+ * @return float64 The declination in degrees
+ * @return float64 The equation of time in minutes
+ */
+func solarPosition(t time.Time) (float64, float64) {
+
+	julianDay := float64(t.Unix())/86400 + 2440587.5
+	century := (julianDay - 2451545) / 36525
+
+	meanLong := math.Mod(280.46646+century*(36000.76983+century*0.0003032), 360)
+	meanAnomaly := 357.52911 + century*(35999.05029-0.0001537*century)
+	eccent := 0.016708634 - century*(0.000042037+0.0000001267*century)
+
+	m := degToRad(meanAnomaly)
+	center := math.Sin(m)*(1.914602-century*(0.004817+0.000014*century)) +
+		math.Sin(2*m)*(0.019993-0.000101*century) +
+		math.Sin(3*m)*0.000289
+
+	omega := degToRad(125.04 - 1934.136*century)
+	apparentLong := meanLong + center - 0.00569 - 0.00478*math.Sin(omega)
+
+	meanObliq := 23 + (26+(21.448-century*(46.815+century*(0.00059-century*0.001813)))/60)/60
+	obliq := degToRad(meanObliq + 0.00256*math.Cos(omega))
+
+	declination := radToDeg(math.Asin(math.Sin(obliq) * math.Sin(degToRad(apparentLong))))
+
+	y := math.Tan(obliq/2) * math.Tan(obliq/2)
+	l := degToRad(meanLong)
+	eqTime := 4 * radToDeg(y*math.Sin(2*l)-
+		2*eccent*math.Sin(m)+
+		4*eccent*y*math.Sin(m)*math.Cos(2*l)-
+		0.5*y*y*math.Sin(4*l)-
+		1.25*eccent*eccent*math.Sin(2*m))
+
+	return declination, eqTime
+}
+
+/**
+ * @name SolarElevation
+ * @brief Get the geometric elevation of the sun
+ * @param lat The latitude
+ * @param lng The longtitude
+ * @param t The time
+ * @return float64 The elevation in degrees, negative if the sun is below horizon
+ */
+func SolarElevation(lat float64, lng float64, t time.Time) float64 {
+
+	declination, eqTime := solarPosition(t)
+
+	utc := t.UTC()
+	minutes := float64(utc.Hour()*60+utc.Minute()) + float64(utc.Second())/60
+	trueSolarTime := math.Mod(minutes+eqTime+4*lng, 1440)
+	hourAngle := degToRad(trueSolarTime/4 - 180)
+
+	phi := degToRad(lat)
+	delta := degToRad(declination)
+	cosZenith := math.Sin(phi)*math.Sin(delta) + math.Cos(phi)*math.Cos(delta)*math.Cos(hourAngle)
+
+	return 90 - radToDeg(math.Acos(math.Max(-1, math.Min(1, cosZenith))))
+}
+
+/**
+ * @name IsDark
+ * @brief Check if the sun is below civil twilight
+ * @param lat The latitude
+ * @param lng The longtitude
+ * @param t The time
+ * @return bool True if it is dark outside
+ */
+func IsDark(lat float64, lng float64, t time.Time) bool {
+	return SolarElevation(lat, lng, t) < SOLAR_ELEVATION_DARK
+}
+
+/**
+ * @name solarEvent
+ * @brief Get the time the sun passes the zenith, it is refined with the sun position of that time
+ * @param lat The latitude
+ * @param lng The longtitude
+ * @param midnight The midnight in UTC of the date
+ * @param zenith The zenith in degrees e.g. SOLAR_ZENITH_OFFICIAL
+ * @param rising True for the morning event, false for the evening one
+ * @return time.Time The time
+ * @return error errNoSunrise if the sun does not pass the zenith on that day
+ */
+func solarEvent(lat float64, lng float64, midnight time.Time, zenith float64, rising bool) (time.Time, error) {
+
+	// start from solar noon and refine twice
+	t := midnight.Add(12 * time.Hour)
+	for i := 0; i < 3; i++ {
+		declination, eqTime := solarPosition(t)
+
+		phi := degToRad(lat)
+		delta := degToRad(declination)
+		cosHourAngle := (math.Cos(degToRad(zenith)) - math.Sin(phi)*math.Sin(delta)) / (math.Cos(phi) * math.Cos(delta))
+		if cosHourAngle > 1 || cosHourAngle < -1 {
+			return time.Time{}, errNoSunrise
+		}
+		hourAngle := radToDeg(math.Acos(cosHourAngle))
+		if rising {
+			hourAngle = -hourAngle
+		}
+
+		minutes := 720 - 4*(lng-hourAngle) - eqTime
+		t = midnight.Add(time.Duration(minutes * float64(time.Minute)))
+	}
+
+	return t, nil
+}
+
+/**
+ * @name SunTimesOf
+ * @brief Calculate sunrise, sunset, civil twilight and solar noon of the date
+ * @param lat The latitude
+ * @param lng The longtitude
+ * @param date The date, times are returned in its time zone
+ * @return *SunTimes The sun times
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func SunTimesOf(lat float64, lng float64, date time.Time) (*SunTimes, error) {
+
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return nil, errors.New("invalid latitude or longtitude")
+	}
+
+	zone := date.Location()
+	year, month, day := date.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	_, eqTime := solarPosition(midnight.Add(12 * time.Hour))
+	noon := midnight.Add(time.Duration((720 - 4*lng - eqTime) * float64(time.Minute)))
+
+	sunrise, err := solarEvent(lat, lng, midnight, SOLAR_ZENITH_OFFICIAL, true)
+	if err != nil {
+		return nil, err
+	}
+	sunset, err := solarEvent(lat, lng, midnight, SOLAR_ZENITH_OFFICIAL, false)
+	if err != nil {
+		return nil, err
+	}
+
+	times := SunTimes{
+		Sunrise:   sunrise.In(zone),
+		Sunset:    sunset.In(zone),
+		SolarNoon: noon.In(zone),
+		DayLength: sunset.Sub(sunrise),
+	}
+	if dawn, err := solarEvent(lat, lng, midnight, SOLAR_ZENITH_CIVIL, true); err == nil {
+		times.CivilDawn = dawn.In(zone)
+	}
+	if dusk, err := solarEvent(lat, lng, midnight, SOLAR_ZENITH_CIVIL, false); err == nil {
+		times.CivilDusk = dusk.In(zone)
+	}
+
+	return &times, nil
+}
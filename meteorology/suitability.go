@@ -0,0 +1,227 @@
+/****************************************************************************
+ * This file is score of weather suitability for going out.                 *
+ * The mapping table can be loaded from configuration.                      *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"fmt"
+	"sort"
+)
+
+/**
+ * Penalty of weather description, e.g. "occasional showers"
+ * The description is decoded into WX_ flags and all of them must match.
+ */
+type WxPenalty struct {
+	Wx      string
+	Penalty int
+}
+
+/**
+ * Penalty when probability of precipitation reaches Pop
+ */
+type PopPenalty struct {
+	Pop     int
+	Penalty int
+}
+
+/**
+ * Penalty of comfort index, e.g. "hot", "very cold"
+ */
+type ComfortPenalty struct {
+	Comfort string
+	Penalty int
+}
+
+/**
+ * Recommended maximum walking distance in meters when score reaches Score
+ */
+type DistanceStep struct {
+	Score    int
+	Distance int
+}
+
+/**
+ * Mapping table from weather to suitability score
+ * The first matched row of Wx is used, the highest reached row of Pop
+ * and the highest penalty of Comfort are used. Temperature out of
+ * [TempLow, TempHigh] costs TempPenalty per degree.
+ */
+type SuitabilityTable struct {
+	Wx          []WxPenalty
+	Pop         []PopPenalty
+	Comfort     []ComfortPenalty
+	TempLow     int
+	TempHigh    int
+	TempPenalty int
+	Distances   []DistanceStep
+}
+
+/**
+ * Suitability of weather for going out
+ */
+type Suitability struct {
+	Score       int      `json:"score" bson:"score"`             // 0 to 100, the higher the better
+	MaxDistance int      `json:"maxDistance" bson:"maxDistance"` // recommended maximum walking distance in meters
+	Reasons     []string `json:"reasons" bson:"reasons"`         // rows of table which cost score
+}
+
+const (
+	SUITABILITY_SCORE_BEST  = 100
+	SUITABILITY_SCORE_WORST = 0
+)
+
+var DefaultSuitabilityTable = SuitabilityTable{
+	Wx: []WxPenalty{
+		{"occasional thundershowers", 30},
+		{"thundershowers", 40},
+		{"thunderstorms", 45},
+		{"light rain", 15},
+		{"occasional rain", 20},
+		{"rain", 30},
+		{"occasional showers", 15},
+		{"showers", 25},
+		{"fog", 10},
+	},
+	Pop: []PopPenalty{
+		{30, 10},
+		{50, 20},
+		{70, 35},
+	},
+	Comfort: []ComfortPenalty{
+		{"very cold", 30},
+		{"cold", 15},
+		{"chilly", 5},
+		{"hot", 10},
+		{"very hot", 30},
+	},
+	TempLow:     15,
+	TempHigh:    30,
+	TempPenalty: 1,
+	Distances: []DistanceStep{
+		{80, 1500},
+		{60, 800},
+		{40, 400},
+		{0, 100},
+	},
+}
+
+/**
+ * @name Validate
+ * @brief Check if every row of table can be decoded
+ * @return error The Error description, this will be nil if no error occurs
+ */
+func (table *SuitabilityTable) Validate() error {
+
+	for _, row := range table.Wx {
+		if transformWxToEnum(row.Wx) == 0 {
+			return fmt.Errorf("unknown weather in suitability table: %s", row.Wx)
+		}
+	}
+	for _, row := range table.Comfort {
+		if comfortLevelOf(row.Comfort) < 0 {
+			return fmt.Errorf("unknown comfort in suitability table: %s", row.Comfort)
+		}
+	}
+	if table.TempLow > table.TempHigh {
+		return fmt.Errorf("invalid temperature range in suitability table: %d > %d", table.TempLow, table.TempHigh)
+	}
+	if len(table.Distances) == 0 {
+		return fmt.Errorf("no distance in suitability table")
+	}
+
+	return nil
+}
+
+/**
+ * @name Score
+ * @brief Score the weather for going out
+ * @param weather The weather
+ * @return Suitability The score and recommended maximum walking distance
+ */
+func (table *SuitabilityTable) Score(weather *Weather) Suitability {
+
+	score := SUITABILITY_SCORE_BEST
+	reasons := []string{}
+
+	for _, row := range table.Wx {
+		if weather.HasWx(transformWxToEnum(row.Wx)) {
+			score -= row.Penalty
+			reasons = append(reasons, row.Wx)
+			break
+		}
+	}
+
+	popPenalty := 0
+	for _, row := range table.Pop {
+		if weather.Pop >= row.Pop && row.Penalty > popPenalty {
+			popPenalty = row.Penalty
+		}
+	}
+	if popPenalty > 0 {
+		score -= popPenalty
+		reasons = append(reasons, fmt.Sprintf("%d%% chance of rain", weather.Pop))
+	}
+
+	comfortPenalty, comfort := 0, ""
+	for _, row := range table.Comfort {
+		level := comfortLevelOf(row.Comfort)
+		if level >= 0 && weather.HasComfort(comfortScale[level].ci) && row.Penalty > comfortPenalty {
+			comfortPenalty, comfort = row.Penalty, row.Comfort
+		}
+	}
+	if comfortPenalty > 0 {
+		score -= comfortPenalty
+		reasons = append(reasons, comfort)
+	}
+
+	if weather.MinTemp < table.TempLow {
+		score -= (table.TempLow - weather.MinTemp) * table.TempPenalty
+		reasons = append(reasons, fmt.Sprintf("%d°C", weather.MinTemp))
+	}
+	if weather.MaxTemp > table.TempHigh {
+		score -= (weather.MaxTemp - table.TempHigh) * table.TempPenalty
+		reasons = append(reasons, fmt.Sprintf("%d°C", weather.MaxTemp))
+	}
+
+	if score < SUITABILITY_SCORE_WORST {
+		score = SUITABILITY_SCORE_WORST
+	}
+
+	return Suitability{Score: score, MaxDistance: table.distanceOf(score), Reasons: reasons}
+}
+
+/**
+ * @name distanceOf
+ * @brief Get the recommended maximum walking distance of the score
+ * @param score The suitability score
+ * @return int The distance in meters of the highest step reached
+ */
+func (table *SuitabilityTable) distanceOf(score int) int {
+
+	steps := append([]DistanceStep{}, table.Distances...)
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].Score > steps[j].Score
+	})
+
+	for _, step := range steps {
+		if score >= step.Score {
+			return step.Distance
+		}
+	}
+	if len(steps) > 0 {
+		return steps[len(steps)-1].Distance
+	}
+
+	return 0
+}
+
+/**
+ * @name OutingSuitability
+ * @brief Score the weather for going out with DefaultSuitabilityTable
+ * @return Suitability The score and recommended maximum walking distance
+ */
+func (weather *Weather) OutingSuitability() Suitability {
+	return DefaultSuitabilityTable.Score(weather)
+}
@@ -0,0 +1,224 @@
+/****************************************************************************
+ * This file is formatter of weather into a short sentence.                 *
+ * Sentences are rendered in en and zh-TW.                                  *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"fmt"
+	"strings"
+)
+
+type wxWord struct {
+	wx int
+	en string
+	zh string
+}
+
+/**
+ * Sky of the weather, the qualified sky must be listed first
+ */
+var wxSkyWords = []wxWord{
+	{WX_MOSTLY + WX_CLEAR, "mostly clear", "晴時多雲"},
+	{WX_PARTLY + WX_CLEAR, "partly clear", "多雲時晴"},
+	{WX_MOSTLY + WX_CLOUDY, "mostly cloudy", "多雲時陰"},
+	{WX_PARTLY + WX_CLOUDY, "partly cloudy", "多雲"},
+	{WX_CLOUDY, "cloudy", "陰"},
+	{WX_CLEAR, "clear", "晴"},
+}
+
+/**
+ * Kinds of precipitation, they are joined by "or"
+ */
+var wxPrecipitationWords = []wxWord{
+	{WX_SHOWERS, "showers", "陣雨"},
+	{WX_THUNDERSHOWERS, "thundershowers", "雷陣雨"},
+	{WX_THUNDERSTORMS, "thunderstorms", "雷雨"},
+	{WX_RAIN, "rain", "雨"},
+}
+
+var wxFogWord = wxWord{WX_FOG, "fog", "有霧"}
+
+/**
+ * Qualifiers of precipitation in the order they are written
+ */
+var wxQualifierWords = []wxWord{
+	{WX_LOCAL, "local", "局部"},
+	{WX_AFTERNOON, "afternoon", "午後"},
+	{WX_OCCASIONAL, "occasional", "短暫"},
+	{WX_LIGHTLY, "light", "小"},
+}
+
+/**
+ * @name wxText
+ * @brief Render WX_ bitmap as a phrase
+ * @param wx The WX_ bitmap
+ * @param zh True to render in zh-TW
+ * @return string The phrase e.g. Mostly cloudy with occasional showers, 多雲時陰短暫陣雨
+ */
+func wxText(wx int, zh bool) string {
+
+	word := func(w wxWord) string {
+		if zh {
+			return w.zh
+		}
+		return w.en
+	}
+
+	sky := ""
+	for _, w := range wxSkyWords {
+		if wx&w.wx == w.wx {
+			sky = word(w)
+			break
+		}
+	}
+
+	kinds := []string{}
+	for _, w := range wxPrecipitationWords {
+		if wx&w.wx != 0 {
+			kinds = append(kinds, word(w))
+		}
+	}
+
+	precipitation := ""
+	if len(kinds) > 0 {
+		qualifiers := []string{}
+		for _, w := range wxQualifierWords {
+			// 小 is only written before 雨 in zh-TW
+			if w.wx == WX_LIGHTLY && zh && (len(kinds) > 1 || wx&WX_RAIN == 0) {
+				continue
+			}
+			if wx&w.wx != 0 {
+				qualifiers = append(qualifiers, word(w))
+			}
+		}
+		if zh {
+			precipitation = strings.Join(qualifiers, "") + strings.Join(kinds, "或")
+		} else {
+			precipitation = strings.Join(append(qualifiers, strings.Join(kinds, " or ")), " ")
+		}
+	}
+
+	fog := ""
+	if wx&WX_FOG != 0 {
+		fog = word(wxFogWord)
+	}
+
+	if zh {
+		return sky + precipitation + fog
+	}
+
+	parts := []string{}
+	for _, part := range []string{precipitation, fog} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	text := ""
+	switch {
+	case sky != "" && len(parts) > 0:
+		text = sky + " with " + strings.Join(parts, " and ")
+	case sky != "":
+		text = sky
+	default:
+		text = strings.Join(parts, " and ")
+	}
+
+	if text == "" {
+		return ""
+	}
+
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+/**
+ * @name comfortText
+ * @brief Render CI_ bitmap as the range of comfort
+ * @param ci The CI_ bitmap
+ * @param zh True to render in zh-TW
+ * @return string The range e.g. comfortable to hot, 舒適至悶熱
+ */
+func comfortText(ci int, zh bool) string {
+
+	levels := []string{}
+	for _, level := range comfortScale {
+		if ci&level.ci == 0 {
+			continue
+		}
+		if zh {
+			levels = append(levels, level.names[0])
+		} else {
+			levels = append(levels, strings.ToLower(level.names[1]))
+		}
+	}
+
+	switch {
+	case len(levels) == 0:
+		return ""
+	case len(levels) == 1:
+		return levels[0]
+	case zh:
+		return levels[0] + "至" + levels[len(levels)-1]
+	default:
+		return levels[0] + " to " + levels[len(levels)-1]
+	}
+}
+
+/**
+ * @name Summary
+ * @brief Render the weather as a short sentence
+ * e.g. "Mostly cloudy with occasional showers, 26–30°C, 30% chance of rain, comfortable to hot"
+ * or "多雲時陰短暫陣雨，26–30°C，降雨機率 30%，舒適至悶熱" of a CWB forecast.
+ * Apparent temperature and UV index are added if the source supplies them, and the comfort
+ * range is added if ComfortIndex is set, CWB always sets it and openWeatherMap sets it by temperature and humidity.
+ * @param language The language e.g. en, zh-TW, en is used for unknown language
+ * @return string The sentence
+ */
+func (weather *Weather) Summary(language string) string {
+
+	zh := isChinese(language)
+	parts := []string{}
+
+	if text := wxText(weather.Wx, zh); text != "" {
+		parts = append(parts, text)
+	}
+
+	if weather.MinTemp == weather.MaxTemp {
+		parts = append(parts, fmt.Sprintf("%d°C", weather.MaxTemp))
+	} else {
+		parts = append(parts, fmt.Sprintf("%d–%d°C", weather.MinTemp, weather.MaxTemp))
+	}
+
+	if weather.ApparentTempKnown && (!weather.TempKnown || weather.ApparentTemp != weather.Temp) {
+		if zh {
+			parts = append(parts, fmt.Sprintf("體感 %d°C", weather.ApparentTemp))
+		} else {
+			parts = append(parts, fmt.Sprintf("feels like %d°C", weather.ApparentTemp))
+		}
+	}
+
+	if zh {
+		parts = append(parts, fmt.Sprintf("降雨機率 %d%%", weather.Pop))
+	} else {
+		parts = append(parts, fmt.Sprintf("%d%% chance of rain", weather.Pop))
+	}
+
+	if weather.UVIndex > 0 {
+		if zh {
+			parts = append(parts, fmt.Sprintf("紫外線 %d %s", weather.UVIndex, weather.UVLevel(language)))
+		} else {
+			parts = append(parts, fmt.Sprintf("UV %d (%s)", weather.UVIndex, weather.UVLevel(language)))
+		}
+	}
+
+	if text := comfortText(weather.ComfortIndex, zh); text != "" {
+		parts = append(parts, text)
+	}
+
+	if zh {
+		return strings.Join(parts, "，")
+	}
+
+	return strings.Join(parts, ", ")
+}
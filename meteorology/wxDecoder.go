@@ -0,0 +1,194 @@
+/****************************************************************************
+ * This file is decoder of weather description into WX_ bitmap.             *
+ * It handles English and Chinese descriptions and the Wx code of CWB.      *
+ ****************************************************************************/
+package meteorology
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+type wxPhrase struct {
+	phrase string
+	wx     int
+}
+
+/**
+ * Chinese phrases used by CWB zh-TW datasets, e.g. 多雲時陰短暫陣雨
+ * The longer phrase must be listed before the shorter one it contains,
+ * because the decoder always takes the first phrase matched at a position.
+ */
+var wxChinesePhrases = []wxPhrase{
+	{"晴時多雲", WX_MOSTLY + WX_CLEAR},
+	{"多雲時晴", WX_PARTLY + WX_CLEAR},
+	{"多雲時陰", WX_MOSTLY + WX_CLOUDY},
+	{"陰時多雲", WX_MOSTLY + WX_CLOUDY},
+	{"雷陣雨", WX_THUNDERSHOWERS},
+	{"多雲", WX_PARTLY + WX_CLOUDY},
+	{"陰天", WX_CLOUDY},
+	{"晴天", WX_CLEAR},
+	{"短暫", WX_OCCASIONAL},
+	{"陣雨", WX_SHOWERS},
+	{"雷雨", WX_THUNDERSTORMS},
+	{"小雨", WX_LIGHTLY + WX_RAIN},
+	{"局部", WX_LOCAL},
+	{"午後", WX_AFTERNOON},
+	{"偶", WX_OCCASIONAL},
+	{"陰", WX_CLOUDY},
+	{"晴", WX_CLEAR},
+	{"霧", WX_FOG},
+	{"雨", WX_RAIN},
+}
+
+/**
+ * English words used by CWB en datasets and openWeatherMap descriptions
+ */
+var wxEnglishWords = map[string]int{
+	"CLEAR":          WX_CLEAR,
+	"SUNNY":          WX_CLEAR,
+	"CLOUDY":         WX_CLOUDY,
+	"CLOUDS":         WX_CLOUDY,
+	"OVERCAST":       WX_CLOUDY,
+	"FOG":            WX_FOG,
+	"FOGGY":          WX_FOG,
+	"MIST":           WX_FOG,
+	"HAZE":           WX_FOG,
+	"RAIN":           WX_RAIN,
+	"DRIZZLE":        WX_LIGHTLY + WX_RAIN,
+	"SHOWER":         WX_SHOWERS,
+	"SHOWERS":        WX_SHOWERS,
+	"THUNDERSTORM":   WX_THUNDERSTORMS,
+	"THUNDERSTORMS":  WX_THUNDERSTORMS,
+	"THUNDERSHOWER":  WX_THUNDERSHOWERS,
+	"THUNDERSHOWERS": WX_THUNDERSHOWERS,
+	"LIGHT":          WX_LIGHTLY,
+	"LIGHTLY":        WX_LIGHTLY,
+	"PARTLY":         WX_PARTLY,
+	"MOSTLY":         WX_MOSTLY,
+	"OCCASIONAL":     WX_OCCASIONAL,
+	"LOCAL":          WX_LOCAL,
+	"AFTERNOON":      WX_AFTERNOON,
+}
+
+/**
+ * The Wx code (parameterValue) of F-C0032 datasets
+ * Only codes observed in the zh-TW and en datasets are listed, the code is
+ * used when the description itself can not be decoded, other codes are logged.
+ */
+var wxCodeTable = map[int]int{
+	1:  WX_CLEAR,
+	2:  WX_PARTLY + WX_CLOUDY,
+	5:  WX_MOSTLY + WX_CLOUDY,
+	6:  WX_MOSTLY + WX_CLOUDY,
+	7:  WX_PARTLY + WX_CLEAR,
+	8:  WX_MOSTLY + WX_CLEAR,
+	12: WX_PARTLY + WX_CLOUDY + WX_OCCASIONAL + WX_SHOWERS,
+	17: WX_PARTLY + WX_CLOUDY + WX_OCCASIONAL + WX_SHOWERS + WX_THUNDERSTORMS,
+	18: WX_PARTLY + WX_CLOUDY + WX_AFTERNOON + WX_OCCASIONAL + WX_THUNDERSHOWERS,
+	31: WX_CLOUDY + WX_SHOWERS + WX_THUNDERSTORMS,
+	36: WX_MOSTLY + WX_CLOUDY + WX_SHOWERS + WX_THUNDERSTORMS,
+}
+
+/**
+ * Wx codes which are not in wxCodeTable and whose description can not be decoded,
+ * each one is logged once so a new code of CWB is noticed
+ */
+var unknownWxCodes = struct {
+	mutex sync.Mutex
+	codes map[int]string
+}{codes: map[int]string{}}
+
+/**
+ * @name reportUnknownWx
+ * @brief Log the Wx code and description which can not be decoded, once for each code
+ * @param desc The description
+ * @param code The Wx code from CWB
+ */
+func reportUnknownWx(desc string, code int) {
+
+	unknownWxCodes.mutex.Lock()
+	defer unknownWxCodes.mutex.Unlock()
+
+	if _, ok := unknownWxCodes.codes[code]; ok {
+		return
+	}
+	unknownWxCodes.codes[code] = desc
+	log.Println("meteorology: unknown Wx code", code, desc)
+}
+
+/**
+ * @name transformWxToEnum
+ * @brief Decode English weather description into WX_ bitmap
+ * @param desc The description, e.g. MOSTLY CLOUDY WITH SHOWERS OR THUNDERSTORMS
+ * @return int The WX_ bitmap, 0 if nothing can be decoded
+ */
+func transformWxToEnum(desc string) int {
+
+	res := 0
+
+	for _, word := range strings.FieldsFunc(strings.ToUpper(desc), isWordSeparator) {
+		res |= wxEnglishWords[word]
+	}
+
+	return res
+}
+
+/**
+ * @name transformChineseWxToEnum
+ * @brief Decode Chinese weather description into WX_ bitmap
+ * @param desc The description, e.g. 多雲午後短暫雷陣雨
+ * @return int The WX_ bitmap, 0 if nothing can be decoded
+ */
+func transformChineseWxToEnum(desc string) int {
+
+	res := 0
+
+	for len(desc) > 0 {
+		matched := false
+		for _, p := range wxChinesePhrases {
+			if strings.HasPrefix(desc, p.phrase) {
+				res |= p.wx
+				desc = desc[len(p.phrase):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			// skip connectives like 時, 或, 有
+			_, size := utf8.DecodeRuneInString(desc)
+			desc = desc[size:]
+		}
+	}
+
+	return res
+}
+
+/**
+ * @name decodeWx
+ * @brief Decode weather description and Wx code into WX_ bitmap
+ * @param desc The description in English or Chinese
+ * @param code The Wx code from CWB, 0 if there is no code
+ * @return int The WX_ bitmap, 0 if nothing can be decoded and the code is logged
+ */
+func decodeWx(desc string, code int) int {
+
+	res := transformWxToEnum(desc) | transformChineseWxToEnum(desc)
+	if res != 0 {
+		return res
+	}
+
+	res, ok := wxCodeTable[code]
+	if !ok && code != 0 {
+		reportUnknownWx(desc, code)
+	}
+
+	return res
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) || r > unicode.MaxASCII
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/creack/goproxy"
@@ -11,8 +15,48 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
 	"github.com/xu354cjo1008/eatingFinder/geography/geocoding"
+	"github.com/xu354cjo1008/eatingFinder/meteorology"
 )
 
+/**
+ * Get latitude and longtitude of the query, it is the best candidate if address is given,
+ * e.g. ?lat=25.03&lng=121.56 or ?address=台北101
+ */
+func latlngOfQuery(ctx context.Context, vars url.Values) (float64, float64, error) {
+
+	if varAddress, ok := vars["address"]; ok {
+		language := "en"
+		if varLang, ok := vars["lang"]; ok {
+			language = varLang[0]
+		}
+		candidates, err := geocodeOf(language).GetLatlngByAddressContext(ctx, varAddress[0])
+		if err != nil {
+			return 0, 0, err
+		}
+		return candidates[0].Lat, candidates[0].Lng, nil
+	}
+
+	varLat, ok := vars["lat"]
+	if !ok {
+		return 0, 0, errors.New("lat and lng or address is required")
+	}
+	varLng, ok := vars["lng"]
+	if !ok {
+		return 0, 0, errors.New("lat and lng or address is required")
+	}
+
+	lat, err := strconv.ParseFloat(varLat[0], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	lng, err := strconv.ParseFloat(varLng[0], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return lat, lng, nil
+}
+
 func homeHandler(rw http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(rw, "Home")
 }
@@ -22,29 +66,236 @@ func apiGeocodeHandler(rw http.ResponseWriter, r *http.Request) {
 	log.Println("Api Geocode Handler")
 
 	vars := r.URL.Query()
-	varLat, ok := vars["lat"]
-	if !ok {
+	lat, lng, err := latlngOfQuery(r.Context(), vars)
+	if err != nil {
+		log.Println("error: ", err)
 		rw.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	varLng, ok := vars["lng"]
+
+	city, err := geocodeOf("en").GetCityByLatlngContext(r.Context(), lat, lng)
+
+	if err != nil {
+		log.Println("error: ", err)
+	}
+
+	fmt.Fprintln(rw, city)
+}
+
+func apiLatlngHandler(rw http.ResponseWriter, r *http.Request) {
+
+	log.Println("Api Latlng Handler")
+
+	vars := r.URL.Query()
+	varAddress, ok := vars["address"]
 	if !ok {
 		rw.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	language := "en"
+	if varLang, ok := vars["lang"]; ok {
+		language = varLang[0]
+	}
+
+	candidates, err := geocodeOf(language).GetLatlngByAddressContext(r.Context(), varAddress[0])
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(candidates)
+}
+
+func apiAddressHandler(rw http.ResponseWriter, r *http.Request) {
+
+	log.Println("Api Address Handler")
+
+	vars := r.URL.Query()
+	lat, lng, err := latlngOfQuery(r.Context(), vars)
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	language := "en"
+	if varLang, ok := vars["lang"]; ok {
+		language = varLang[0]
+	}
+
+	address, err := geocodeOf(language).GetAddressByLatlngContext(r.Context(), lat, lng)
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
 
-	geocode := geocoding.NewGeocode(config.googleApiKey, "en")
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(address)
+}
 
-	lat, _ := strconv.ParseFloat(varLat[0], 64)
-	lng, _ := strconv.ParseFloat(varLng[0], 64)
+func apiWeatherHandler(rw http.ResponseWriter, r *http.Request) {
 
-	city, err := geocode.GetCityByLatlng(lat, lng)
+	log.Println("Api Weather Handler")
 
+	vars := r.URL.Query()
+	lat, lng, err := latlngOfQuery(r.Context(), vars)
 	if err != nil {
 		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	fmt.Fprintln(rw, city)
+	meteo, err := meteorologyOf()
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	weather, err := weatherOfLatlng(meteo, lat, lng)
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	language := "en"
+	if varLang, ok := vars["lang"]; ok {
+		language = varLang[0]
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(struct {
+		*meteorology.Weather
+		Summary string `json:"summary"`
+	}{weather, weather.Summary(language)})
+}
+
+func apiObservationHandler(rw http.ResponseWriter, r *http.Request) {
+
+	log.Println("Api Observation Handler")
+
+	vars := r.URL.Query()
+	lat, lng, err := latlngOfQuery(r.Context(), vars)
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	meteo, err := meteorologyOf()
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	observation, err := meteo.GetObservation(lat, lng)
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(observation)
+}
+
+func apiNowcastHandler(rw http.ResponseWriter, r *http.Request) {
+
+	log.Println("Api Nowcast Handler")
+
+	vars := r.URL.Query()
+	lat, lng, err := latlngOfQuery(r.Context(), vars)
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	meteo, err := meteorologyOf()
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	nowcast, err := meteo.GetNowcast(lat, lng)
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(struct {
+		*meteorology.Nowcast
+		TotalRain float64 `json:"totalRain"`
+	}{nowcast, nowcast.TotalRain()})
+}
+
+func apiSunHandler(rw http.ResponseWriter, r *http.Request) {
+
+	log.Println("Api Sun Handler")
+
+	vars := r.URL.Query()
+	lat, lng, err := latlngOfQuery(r.Context(), vars)
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	meteo, err := meteorologyOf()
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sun, err := meteo.GetSunTimes(lat, lng)
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(struct {
+		*meteorology.SunTimes
+		Elevation float64 `json:"elevation"`
+		IsDark    bool    `json:"isDark"`
+	}{sun, meteorology.SolarElevation(lat, lng, meteo.Now()), meteo.IsDark(lat, lng)})
+}
+
+func apiGeocodeStatsHandler(rw http.ResponseWriter, r *http.Request) {
+
+	log.Println("Api Geocode Stats Handler")
+
+	stats := geocodeCacheStats()
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(struct {
+		geocoding.CacheStats
+		HitRate float64 `json:"hitRate"`
+	}{stats, stats.HitRate()})
+}
+
+func apiMeteoHealthHandler(rw http.ResponseWriter, r *http.Request) {
+
+	log.Println("Api Meteorology Health Handler")
+
+	meteo, err := meteorologyOf()
+	if err != nil {
+		log.Println("error: ", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(meteo.Health())
 }
 
 func runApiServer() {
@@ -52,6 +303,14 @@ func runApiServer() {
 	r := mux.NewRouter().StrictSlash(false)
 	r.HandleFunc("/", homeHandler)
 	r.HandleFunc("/getCity", apiGeocodeHandler)
+	r.HandleFunc("/getAddress", apiAddressHandler)
+	r.HandleFunc("/getLatlng", apiLatlngHandler)
+	r.HandleFunc("/getWeather", apiWeatherHandler)
+	r.HandleFunc("/getObservation", apiObservationHandler)
+	r.HandleFunc("/getSun", apiSunHandler)
+	r.HandleFunc("/getNowcast", apiNowcastHandler)
+	r.HandleFunc("/getGeocodeStats", apiGeocodeStatsHandler)
+	r.HandleFunc("/getMeteoHealth", apiMeteoHealthHandler)
 
 	n := negroni.Classic()
 	n.UseHandler(r)
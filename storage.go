@@ -2,17 +2,36 @@ package main
 
 import (
 	"container/list"
+	"context"
 	"errors"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/StefanSchroeder/Golang-Ellipsoid/ellipsoid"
+	"github.com/xu354cjo1008/eatingFinder/geography/geocoding"
 	"github.com/xu354cjo1008/eatingFinder/meteorology"
 
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
+/**
+ * Mongo is given up after the timeout instead of blocking the caller,
+ * the geocode cache backend doesn't reconnect until the retry interval passes
+ */
+const (
+	STORAGE_DIAL_TIMEOUT         = 5 * time.Second
+	GEOCODE_CACHE_RETRY_INTERVAL = time.Minute
+)
+
+/**
+ * An archived observation is used for past weather only if it is measured this close to the time
+ */
+const WEATHER_OBSERVATION_GAP = 30 * time.Minute
+
+var errGeocodeCacheUnavailable = errors.New("geocode cache backend is unavailable")
+
 type Storage struct {
 	databaseUrl string
 	sessionMaxN int
@@ -38,6 +57,8 @@ type ChoiceElement struct {
 	Lat        float64
 	Lng        float64
 	Time       time.Time
+	County     string
+	District   string
 	Restaurant RestaurantInfo
 	Weather    meteorology.Weather
 }
@@ -145,13 +166,287 @@ func (storage *Storage) findChoiceListByLocation(db *mgo.Database, lat float64,
 	return result
 }
 
+func (storage *Storage) insertWeatherArchive(db *mgo.Database, record meteorology.ArchiveRecord) error {
+
+	collection := db.C("weather_archive")
+	_, err := collection.Upsert(bson.M{"dataId": record.DataId, "issueTime": record.IssueTime}, record)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+/**
+ * Get weather at past time from archived CWB forecasts and observations,
+ * the latest forecast issued before the time is used first,
+ * then temperature, humidity and wind are replaced by the observation nearest to the time
+ */
+func (storage *Storage) GetWeatherAt(db *mgo.Database, location string, lat float64, lng float64, pastTime time.Time) (*meteorology.Weather, error) {
+
+	weather, forecastErr := storage.forecastAt(db, location, pastTime)
+
+	obs, err := storage.observationAt(db, lat, lng, pastTime)
+	if err != nil {
+		if forecastErr != nil {
+			return nil, forecastErr
+		}
+		return weather, nil
+	}
+	if weather == nil {
+		weather = &meteorology.Weather{Source: meteorology.METEO_SOURCE_CWB}
+	}
+	obs.Apply(weather)
+
+	return weather, nil
+}
+
+/**
+ * Get weather of the location at past time from archived CWB forecasts
+ */
+func (storage *Storage) forecastAt(db *mgo.Database, location string, pastTime time.Time) (*meteorology.Weather, error) {
+
+	collection := db.C("weather_archive")
+
+	var records []meteorology.ArchiveRecord
+	err := collection.Find(bson.M{
+		"dataId": bson.M{
+			"$in": []string{meteorology.CENTRAL_WEATHER_BUREAU_DATA_ID_EN, meteorology.CENTRAL_WEATHER_BUREAU_DATA_ID_ZH},
+		},
+		"issueTime": bson.M{
+			"$lte": pastTime,
+		},
+	}).Sort("-issueTime").Limit(6).All(&records)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		weather, err := meteorology.WeatherOfArchive(record, location, pastTime)
+		if err == nil {
+			return weather, nil
+		}
+	}
+
+	return nil, errors.New("no archived weather at the time")
+}
+
+/**
+ * Get observation of the nearest station from the archived observation nearest to the time,
+ * within WEATHER_OBSERVATION_GAP
+ */
+func (storage *Storage) observationAt(db *mgo.Database, lat float64, lng float64, pastTime time.Time) (*meteorology.Observation, error) {
+
+	collection := db.C("weather_archive")
+
+	// the latest one before the time and the first one after it
+	candidates := []meteorology.ArchiveRecord{}
+	for _, query := range []struct {
+		op   string
+		sort string
+	}{{"$lte", "-issueTime"}, {"$gt", "issueTime"}} {
+		var records []meteorology.ArchiveRecord
+		err := collection.Find(bson.M{
+			"dataId": meteorology.CENTRAL_WEATHER_BUREAU_OBSERVATION_ID,
+			"issueTime": bson.M{
+				query.op: pastTime,
+			},
+		}).Sort(query.sort).Limit(1).All(&records)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, records...)
+	}
+
+	var nearest *meteorology.Observation
+	var gap time.Duration
+	for _, record := range candidates {
+		d := record.IssueTime.Sub(pastTime)
+		if d < 0 {
+			d = -d
+		}
+		if d > WEATHER_OBSERVATION_GAP || (nearest != nil && d >= gap) {
+			continue
+		}
+		obs, err := meteorology.ObservationOfArchive(record, lat, lng, pastTime)
+		if err != nil {
+			continue
+		}
+		nearest, gap = obs, d
+	}
+	if nearest == nil {
+		return nil, errors.New("no archived observation at the time")
+	}
+
+	return nearest, nil
+}
+
+/**
+ * Archiver of meteorology which stores datasets in weather_archive,
+ * the db is opened at the first archive and kept for later ones
+ */
+type weatherArchiver struct {
+	storage *Storage
+	db      *mgo.Database
+	mutex   sync.Mutex
+}
+
+func (archiver *weatherArchiver) Archive(record meteorology.ArchiveRecord) error {
+
+	archiver.mutex.Lock()
+	defer archiver.mutex.Unlock()
+
+	if archiver.db == nil {
+		db, err := archiver.storage.getDb(config.dbName, config.dbUsername, config.dbPassword)
+		if err != nil {
+			return err
+		}
+		archiver.db = db
+	}
+
+	return archiver.storage.insertWeatherArchive(archiver.db, record)
+}
+
+func (storage *Storage) findGeocodeCache(db *mgo.Database, key string) (*geocoding.CacheRecord, error) {
+
+	collection := db.C("geocode_cache")
+	record := geocoding.CacheRecord{}
+	err := collection.Find(bson.M{"key": key}).One(&record)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (storage *Storage) upsertGeocodeCache(db *mgo.Database, record geocoding.CacheRecord) error {
+
+	collection := db.C("geocode_cache")
+	_, err := collection.Upsert(bson.M{"key": record.Key}, record)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+/**
+ * Persistent backend of address cache which stores addresses in geocode_cache,
+ * so they are kept across restarts and every meteoUtil run.
+ * It is called in lookups, so connecting never outlasts the deadline of lookup
+ * and the backend is disabled for GEOCODE_CACHE_RETRY_INTERVAL after a failure.
+ */
+type geocodeCacheBackend struct {
+	storage    *Storage
+	db         *mgo.Database
+	mutex      sync.Mutex
+	connecting bool
+	failedAt   time.Time
+}
+
+/**
+ * Get the db, only one lookup connects at a time and the others skip the backend
+ */
+func (backend *geocodeCacheBackend) getDb(ctx context.Context) (*mgo.Database, error) {
+
+	timeout := STORAGE_DIAL_TIMEOUT
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(time.Now()) < timeout {
+		timeout = deadline.Sub(time.Now())
+	}
+
+	backend.mutex.Lock()
+	if backend.db != nil {
+		db := backend.db
+		backend.mutex.Unlock()
+		return db, nil
+	}
+	// mgo waits forever with zero timeout
+	if backend.connecting || timeout <= 0 || time.Now().Sub(backend.failedAt) < GEOCODE_CACHE_RETRY_INTERVAL {
+		backend.mutex.Unlock()
+		return nil, errGeocodeCacheUnavailable
+	}
+	backend.connecting = true
+	backend.mutex.Unlock()
+
+	db, err := backend.storage.getDbWithTimeout(config.dbName, config.dbUsername, config.dbPassword, timeout)
+
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	backend.connecting = false
+	if err != nil {
+		backend.failedAt = time.Now()
+		return nil, err
+	}
+	db.Session.SetSocketTimeout(STORAGE_DIAL_TIMEOUT)
+	backend.db = db
+
+	return db, nil
+}
+
+/**
+ * Disable the backend for a while if mongo fails after connected
+ */
+func (backend *geocodeCacheBackend) fail(err error) error {
+
+	if err != nil {
+		backend.mutex.Lock()
+		backend.failedAt = time.Now()
+		backend.mutex.Unlock()
+	}
+
+	return err
+}
+
+func (backend *geocodeCacheBackend) available() bool {
+
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	return time.Now().Sub(backend.failedAt) >= GEOCODE_CACHE_RETRY_INTERVAL
+}
+
+func (backend *geocodeCacheBackend) Load(ctx context.Context, key string) (*geocoding.CacheRecord, error) {
+
+	db, err := backend.getDb(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !backend.available() {
+		return nil, errGeocodeCacheUnavailable
+	}
+
+	record, err := backend.storage.findGeocodeCache(db, key)
+	return record, backend.fail(err)
+}
+
+func (backend *geocodeCacheBackend) Store(ctx context.Context, record geocoding.CacheRecord) error {
+
+	db, err := backend.getDb(ctx)
+	if err != nil {
+		return err
+	}
+	if !backend.available() {
+		return errGeocodeCacheUnavailable
+	}
+
+	return backend.fail(backend.storage.upsertGeocodeCache(db, record))
+}
+
 func (storage *Storage) getDb(name string, user string, password string) (*mgo.Database, error) {
+	return storage.getDbWithTimeout(name, user, password, STORAGE_DIAL_TIMEOUT)
+}
+
+/**
+ * Connect and login to the db, errors are returned so a bad credential doesn't stop the server
+ */
+func (storage *Storage) getDbWithTimeout(name string, user string, password string, timeout time.Duration) (*mgo.Database, error) {
 
 	if storage.sessions.Len() > storage.sessionMaxN {
 		return nil, errors.New("there is no free session can be used")
 	}
 
-	mgoSession, err := mgo.Dial(storage.databaseUrl)
+	mgoSession, err := mgo.DialWithTimeout(storage.databaseUrl, timeout)
 	if err != nil {
 		log.Println("mgoSession failed")
 		return nil, err
@@ -165,7 +460,8 @@ func (storage *Storage) getDb(name string, user string, password string) (*mgo.D
 
 	err = mgoSession.Login(&mgo.Credential{Username: user, Password: password, Source: name})
 	if err != nil {
-		log.Fatalln("can not login ", err)
+		log.Println("can not login ", err)
+		mgoSession.Close()
 		return nil, err
 	}
 